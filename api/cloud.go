@@ -20,6 +20,9 @@ func GetCloud(in *GetCloudInput) (gpuTypes []interface{}, err error) {
 		Query: `
 		query LowestPrice($input: GpuLowestPriceInput!) {
 			gpuTypes {
+			  id
+			  displayName
+			  memoryInGb
 			  lowestPrice(input: $input) {
 				gpuName
 				gpuTypeId
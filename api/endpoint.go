@@ -22,6 +22,8 @@ type CreateTemplateInput struct {
 	Readme            string    `json:"readme"`
 }
 type CreateEndpointInput struct {
+	// Id selects an existing endpoint to update. Leave it empty to create one.
+	Id              string `json:"id,omitempty"`
 	Name            string `json:"name"`
 	TemplateId      string `json:"templateId"`
 	GpuIds          string `json:"gpuIds"`
@@ -36,8 +38,17 @@ type CreateEndpointInput struct {
 
 // there are many more fields in the result of the query but I just care about these for CLI port
 type Endpoint struct {
-	Name string `json:"name"`
-	Id   string
+	Name            string `json:"name"`
+	Id              string
+	TemplateId      string
+	GpuIds          string
+	NetworkVolumeId string
+	Locations       string
+	IdleTimeout     int
+	ScalerType      string
+	ScalerValue     int
+	WorkersMin      int
+	WorkersMax      int
 }
 type EndpointOut struct {
 	Data   *EndpointData   `json:"data"`
@@ -289,3 +300,38 @@ func GetEndpoints() (endpoints []*Endpoint, err error) {
 	endpoints = data.Data.Myself.Endpoints
 	return
 }
+
+func DeleteEndpoint(endpointId string) (err error) {
+	input := Input{
+		Query: `
+		mutation deleteEndpoint($id: String!) {
+			deleteEndpoint(id: $id)
+		}
+		`,
+		Variables: map[string]interface{}{"id": endpointId},
+	}
+	res, err := Query(input)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	rawData, err := io.ReadAll(res.Body)
+	if err != nil {
+		return
+	}
+	if res.StatusCode != 200 {
+		err = fmt.Errorf("statuscode %d: %s", res.StatusCode, string(rawData))
+		return
+	}
+	data := make(map[string]interface{})
+	if err = json.Unmarshal(rawData, &data); err != nil {
+		return
+	}
+	gqlErrors, ok := data["errors"].([]interface{})
+	if ok && len(gqlErrors) > 0 {
+		firstErr, _ := gqlErrors[0].(map[string]interface{})
+		err = errors.New(firstErr["message"].(string))
+		return
+	}
+	return
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Job statuses reported by the serverless job API.
+const (
+	JobCompleted = "COMPLETED"
+	JobFailed    = "FAILED"
+	JobCancelled = "CANCELLED"
+	JobTimedOut  = "TIMED_OUT"
+)
+
+type JobStatus struct {
+	Id     string          `json:"id"`
+	Status string          `json:"status"`
+	Output json.RawMessage `json:"output"`
+	Error  string          `json:"error"`
+}
+
+// Done reports whether the job reached a final status.
+func (j *JobStatus) Done() bool {
+	switch j.Status {
+	case JobCompleted, JobFailed, JobCancelled, JobTimedOut:
+		return true
+	}
+	return false
+}
+
+// RunJob queues a job with payload, a JSON object with an "input" key, on
+// the serverless endpoint.
+func RunJob(endpointId string, payload []byte) (job *JobStatus, err error) {
+	return jobRequest("POST", endpointId, "run", payload)
+}
+
+func GetJobStatus(endpointId string, jobId string) (job *JobStatus, err error) {
+	return jobRequest("GET", endpointId, "status/"+jobId, nil)
+}
+
+// CancelJob cancels a queued or running job on the serverless endpoint.
+func CancelJob(endpointId string, jobId string) (job *JobStatus, err error) {
+	return jobRequest("POST", endpointId, "cancel/"+jobId, nil)
+}
+
+func jobRequest(method string, endpointId string, path string, payload []byte) (job *JobStatus, err error) {
+	endpointUrl := os.Getenv("RUNPOD_ENDPOINT_URL")
+	if endpointUrl == "" {
+		endpointUrl = viper.GetString("endpointUrl")
+	}
+	if endpointUrl == "" {
+		endpointUrl = "https://api.runpod.ai/v2"
+	}
+
+	apiKey := os.Getenv("RUNPOD_API_KEY")
+	if apiKey == "" {
+		apiKey = viper.GetString("apiKey")
+	}
+	if apiKey == "" {
+		return nil, errors.New("API key not found")
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(endpointUrl, "/")+"/"+endpointId+"/"+path, bytes.NewReader(payload))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "RunPod-CLI/"+Version+" ("+runtime.GOOS+"; "+runtime.GOARCH+")")
+
+	client := &http.Client{Timeout: time.Second * 30}
+	res, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	rawData, err := io.ReadAll(res.Body)
+	if err != nil {
+		return
+	}
+	if res.StatusCode != 200 {
+		err = fmt.Errorf("statuscode %d: %s", res.StatusCode, string(rawData))
+		return
+	}
+	job = &JobStatus{}
+	if err = json.Unmarshal(rawData, job); err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type Template struct {
+	Id                string
+	Name              string
+	ImageName         string
+	ContainerDiskInGb int
+	VolumeMountPath   string
+	IsServerless      bool
+	Env               []*PodEnv
+}
+type TemplateOut struct {
+	Data   *TemplateData   `json:"data"`
+	Errors []*GraphQLError `json:"errors"`
+}
+type TemplateData struct {
+	Myself *MySelfDataTemplate
+}
+type MySelfDataTemplate struct {
+	PodTemplates []*Template
+}
+
+func GetTemplates() (templates []*Template, err error) {
+	input := Input{
+		Query: `
+		query Query {
+			myself {
+			  podTemplates {
+				id
+				name
+				imageName
+				containerDiskInGb
+				volumeMountPath
+				isServerless
+				env {
+				  key
+				  value
+				}
+			  }
+			}
+		  }
+		`,
+	}
+	res, err := Query(input)
+	if err != nil {
+		return
+	}
+	if res.StatusCode != 200 {
+		err = fmt.Errorf("statuscode %d", res.StatusCode)
+		return
+	}
+	defer res.Body.Close()
+	rawData, err := io.ReadAll(res.Body)
+	if err != nil {
+		return
+	}
+	data := &TemplateOut{}
+	if err = json.Unmarshal(rawData, data); err != nil {
+		return
+	}
+	if len(data.Errors) > 0 {
+		err = errors.New(data.Errors[0].Message)
+		return
+	}
+	if data.Data == nil || data.Data.Myself == nil || data.Data.Myself.PodTemplates == nil {
+		err = fmt.Errorf("data is nil: %s", string(rawData))
+		return
+	}
+	templates = data.Data.Myself.PodTemplates
+	return
+}
+
+func DeleteTemplate(templateName string) (err error) {
+	input := Input{
+		Query: `
+		mutation deleteTemplate($templateName: String!) {
+			deleteTemplate(templateName: $templateName)
+		}
+		`,
+		Variables: map[string]interface{}{"templateName": templateName},
+	}
+	res, err := Query(input)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	rawData, err := io.ReadAll(res.Body)
+	if err != nil {
+		return
+	}
+	if res.StatusCode != 200 {
+		err = fmt.Errorf("statuscode %d: %s", res.StatusCode, string(rawData))
+		return
+	}
+	data := make(map[string]interface{})
+	if err = json.Unmarshal(rawData, &data); err != nil {
+		return
+	}
+	gqlErrors, ok := data["errors"].([]interface{})
+	if ok && len(gqlErrors) > 0 {
+		firstErr, _ := gqlErrors[0].(map[string]interface{})
+		err = errors.New(firstErr["message"].(string))
+		return
+	}
+	return
+}
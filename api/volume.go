@@ -56,3 +56,38 @@ func GetNetworkVolumes() (volumes []*NetworkVolume, err error) {
 	}
 	return data.Data.Myself.NetworkVolumes, nil
 }
+
+func DeleteNetworkVolume(id string) (err error) {
+	input := Input{
+		Query: `
+		mutation deleteNetworkVolume($input: DeleteNetworkVolumeInput!) {
+			deleteNetworkVolume(input: $input)
+		}
+		`,
+		Variables: map[string]interface{}{"input": map[string]interface{}{"id": id}},
+	}
+	res, err := Query(input)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	rawData, err := io.ReadAll(res.Body)
+	if err != nil {
+		return
+	}
+	if res.StatusCode != 200 {
+		err = fmt.Errorf("statuscode %d: %s", res.StatusCode, string(rawData))
+		return
+	}
+	data := make(map[string]interface{})
+	if err = json.Unmarshal(rawData, &data); err != nil {
+		return
+	}
+	gqlErrors, ok := data["errors"].([]interface{})
+	if ok && len(gqlErrors) > 0 {
+		firstErr, _ := gqlErrors[0].(map[string]interface{})
+		err = errors.New(firstErr["message"].(string))
+		return
+	}
+	return
+}
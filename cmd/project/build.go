@@ -1,38 +1,456 @@
 package project
 
 import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	outputPath string
-	tag        string
+	outputPath  string
+	tag         string
+	buildImage  bool
+	pushImage   bool
+	builderName string
+	buildArgs   []string
+	buildSecret []string
+	contextOnly bool
+	contextPath string
+	forceBuild  bool
 )
 
+//go:embed exampleDockerfile
+var exampleDockerfile string
+
+// generatedDockerfileMarker is the first line of every Dockerfile written by
+// build. Files without it are never overwritten.
+const generatedDockerfileMarker string = "# AUTOGENERATED Dockerfile using airfoil build"
+
 var BuildProjectCmd = &cobra.Command{
 	Use:   "build",
 	Short: "Build Dockerfile for current project",
 	Long: `Builds a local Dockerfile for the project in the current folder.
-You can use this Dockerfile to build an image and deploy it to any API server.`,
-	Run: func(cmd *cobra.Command, args []string) {
+You can use this Dockerfile to build an image and deploy it to any API server.
+With --image the image is also built with docker, podman, nerdctl or buildah, and
+pushed with --push. The tag is recorded for deploy.
 
+The Dockerfile is generated from runpod.toml and marked as generated, so running build
+again replaces it. A Dockerfile that was not generated by airfoil is never overwritten.`,
+	Example: `  airfoil build --include-env
+  airfoil build --image --tag registry.example.com/acme/my-worker:v1 --push
+  airfoil build --image --builder podman --build-arg MODEL=gpt2 --secret HF_TOKEN`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Building Dockerfile...")
-		// Implement the logic for building a Dockerfile here
-
-		// Example of how you might log during the build process:
-		// if err := buildDockerfile(); err != nil {
-		//     logger.Error("Failed to build Dockerfile", zap.Error(err))
-		//     return
-		// }
-
+		if err := buildProject(); err != nil {
+			fmt.Println("Failed to build project:", err)
+			os.Exit(1)
+		}
 	},
 }
 
 func init() {
 	BuildProjectCmd.Flags().StringVarP(&outputPath, "output", "o", "", "Output path for the Dockerfile (default is ./Dockerfile)")
-	BuildProjectCmd.Flags().StringVarP(&tag, "tag", "t", "", "Suggest a tag for the Docker image")
+	BuildProjectCmd.Flags().StringVarP(&tag, "tag", "t", "", "Tag for the image (default is <name>:latest)")
 	BuildProjectCmd.Flags().BoolVar(&includeEnvInDockerfile, "include-env", false, "Incorporate environment variables defined in runpod.toml into the generated Dockerfile")
+	BuildProjectCmd.Flags().BoolVar(&buildImage, "image", false, "Build the image after writing the Dockerfile")
+	BuildProjectCmd.Flags().BoolVar(&pushImage, "push", false, "Push the image after building it (implies --image)")
+	BuildProjectCmd.Flags().StringVar(&builderName, "builder", "", "Container builder to use: docker, podman, nerdctl or buildah (default is the first one found)")
+	BuildProjectCmd.Flags().StringArrayVar(&buildArgs, "build-arg", nil, "Set a build argument as KEY=VALUE (can be repeated)")
+	BuildProjectCmd.Flags().BoolVar(&contextOnly, "context-only", false, "Only write the build context archive, with the Dockerfile at its root, for use with an external builder")
+	BuildProjectCmd.Flags().StringVar(&contextPath, "context-output", filepath.Join(".runpod", "context.tar"), "Path of the archive written by --context-only, gzipped if it ends in .gz")
+	BuildProjectCmd.Flags().StringArrayVar(&buildSecret, "secret", nil, "Expose a secret to the build as ID or ID=ENV_VAR, read from the environment or secrets.enc (can be repeated)")
+	BuildProjectCmd.Flags().BoolVar(&forceBuild, "force", false, "Build the image even if nothing changed since the last build")
+}
+
+func buildProject() error {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+
+	dockerfilePath, err := resolveDockerfilePath(config, outputPath)
+	if err != nil {
+		return err
+	}
+
+	content, err := renderDockerfile(config, includeEnvInDockerfile)
+	if err != nil {
+		return err
+	}
+
+	if contextOnly {
+		archivePath := contextPath
+		if !filepath.IsAbs(archivePath) {
+			archivePath = filepath.Join(config.Dir(), archivePath)
+		}
+		summary, err := writeBuildContextFile(archivePath, config, []byte(content))
+		if err != nil {
+			return err
+		}
+		fmt.Println("Wrote build context", archivePath)
+		printBuildContextSummary(summary)
+		return nil
+	}
+
+	written, err := writeGeneratedFile(dockerfilePath, content)
+	if err != nil {
+		return err
+	}
+	if written {
+		fmt.Println("Wrote", dockerfilePath)
+	} else {
+		fmt.Println(dockerfilePath, "is up to date")
+	}
+
+	imageTag := tag
+	if imageTag == "" {
+		imageTag = config.Name + ":latest"
+	}
+	if !buildImage && !pushImage {
+		fmt.Printf("Build the image with:\n%sdocker build -t %s -f %s %s\n", inputPromptPrefix, imageTag, dockerfilePath, config.Dir())
+		return nil
+	}
+
+	return buildProjectImage(config, []byte(content), imageTag)
+}
+
+// buildProjectImage builds the image with the configured builder, pushes it
+// when asked and records the tag in the project state. The build is skipped
+// when the content hash matches the last image and that image still exists.
+func buildProjectImage(config *ProjectConfig, dockerfile []byte, imageTag string) error {
+	builder, err := newImageBuilder(builderName)
+	if err != nil {
+		return err
+	}
+
+	args, err := parseKeyValues("--build-arg", buildArgs)
+	if err != nil {
+		return err
+	}
+	secrets, err := resolveBuildSecrets(config, buildSecret)
+	if err != nil {
+		return err
+	}
+
+	entries, err := collectBuildContext(config)
+	if err != nil {
+		return err
+	}
+	summary, err := writeBuildContext(io.Discard, config.Dir(), entries, dockerfile)
+	if err != nil {
+		return err
+	}
+	printBuildContextSummary(summary)
+	contentHash := projectContentHash(summary.Digest, args)
+
+	state, err := loadProjectState(config)
+	if err != nil {
+		return err
+	}
+	revision := currentGitRevision(config.Dir())
+
+	built := false
+	previous := state.Image
+	reuse := !forceBuild && previous != nil && previous.ContentHash == contentHash &&
+		previous.Builder == builder.Name() && builder.Exists(previous.Tag)
+	switch {
+	case reuse && previous.Tag == imageTag:
+		fmt.Printf("Image %s is up to date, use --force to rebuild\n", imageTag)
+		if !pushImage || previous.Pushed {
+			return nil
+		}
+	case reuse && builder.Tag(previous.Tag, imageTag) == nil:
+		fmt.Printf("Reusing image %s as %s, nothing changed since it was built\n", previous.Tag, imageTag)
+		state.Image = &ImageState{Tag: imageTag, Builder: builder.Name(), BuiltAt: previous.BuiltAt, ContentHash: contentHash, gitRevision: revision}
+	default:
+		// The builder gets the archived context, not the project folder, so
+		// ignored files stay out of the image and the recorded hash is of
+		// exactly the files that were built.
+		contextDir, err := os.MkdirTemp("", "airfoil-context-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(contextDir)
+		staged, err := stageBuildContext(contextDir, config.Dir(), entries, dockerfile)
+		if err != nil {
+			return fmt.Errorf("preparing build context: %w", err)
+		}
+		if staged.Digest != summary.Digest {
+			fmt.Printf("%sFiles changed while the context was prepared, the image has the current files\n", inputPromptPrefix)
+		}
+
+		fmt.Printf("Building image %s with %s...\n", imageTag, builder.Name())
+		err = builder.Build(imageBuildOptions{
+			ContextDir: contextDir,
+			Dockerfile: filepath.Join(contextDir, "Dockerfile"),
+			Image:      imageTag,
+			BuildArgs:  args,
+			Secrets:    secrets,
+		})
+		if err != nil {
+			return err
+		}
+		state.Image = &ImageState{Tag: imageTag, Builder: builder.Name(), BuiltAt: time.Now().UTC(), ContentHash: projectContentHash(staged.Digest, args), gitRevision: revision}
+		built = true
+	}
+
+	if pushImage {
+		fmt.Printf("Pushing image %s...\n", imageTag)
+		if err := builder.Push(imageTag); err != nil {
+			return err
+		}
+		state.Image.Pushed = true
+	}
+
+	if err := state.save(); err != nil {
+		return err
+	}
+
+	if built {
+		fmt.Println("Built image", imageTag)
+	}
+	return nil
+}
+
+// projectContentHash hashes everything that goes into the image: the digest
+// of the build context archive, which holds the rendered Dockerfile and the
+// project files that are not ignored, and the build arguments. Secret values
+// are not part of the hash, so changing only a secret needs --force.
+func projectContentHash(contextDigest string, args map[string]string) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "context %s\n", contextDigest)
+	for _, key := range sortedKeys(args) {
+		fmt.Fprintf(hash, "build-arg %q=%q\n", key, args[key])
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil))
+}
+
+func printBuildContextSummary(summary *buildContextSummary) {
+	fmt.Printf("%sContext: %d files, %s (archive %s)\n", inputPromptPrefix, summary.Files, formatBytes(summary.Bytes), formatBytes(summary.TarBytes))
+	fmt.Printf("%sDigest:  %s\n", inputPromptPrefix, summary.Digest)
+}
+
+// parseKeyValues parses KEY=VALUE pairs given with flag.
+func parseKeyValues(flag string, pairs []string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, pair := range pairs {
+		key, value, found := strings.Cut(pair, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid %s %q, expected KEY=VALUE", flag, pair)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// resolveBuildSecrets looks up the values of --secret entries, given as ID or
+// ID=ENV_VAR, in the environment and then in the project secrets.
+func resolveBuildSecrets(config *ProjectConfig, entries []string) (map[string]string, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	projectSecrets, err := loadProjectSecrets(config.Dir())
+	if err != nil {
+		return nil, fmt.Errorf("loading project secrets: %w", err)
+	}
+
+	secrets := map[string]string{}
+	for _, entry := range entries {
+		id, name, found := strings.Cut(entry, "=")
+		if !found {
+			name = id
+		}
+		if !envKeyFormat.MatchString(id) || !envKeyFormat.MatchString(name) {
+			return nil, fmt.Errorf("invalid --secret %q, expected ID or ID=ENV_VAR", entry)
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			value, ok = projectSecrets[name]
+		}
+		if !ok {
+			return nil, fmt.Errorf("secret %s not found in the environment or %s", name, secretsFile)
+		}
+		secrets[id] = value
+	}
+	return secrets, nil
+}
+
+// resolveDockerfilePath returns where the Dockerfile is written. An output
+// that is an existing directory gets a Dockerfile inside it.
+func resolveDockerfilePath(config *ProjectConfig, output string) (string, error) {
+	if output == "" {
+		return filepath.Join(config.Dir(), "Dockerfile"), nil
+	}
+
+	output, err := filepath.Abs(output)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(output); err == nil && info.IsDir() {
+		return filepath.Join(output, "Dockerfile"), nil
+	}
+	if _, err := os.Stat(filepath.Dir(output)); err != nil {
+		return "", fmt.Errorf("output directory %s does not exist", filepath.Dir(output))
+	}
+	return output, nil
+}
+
+var (
+	pythonVersionFormat = regexp.MustCompile(`^3\.\d+$`)
+	envKeyFormat        = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// renderDockerfile fills in the Dockerfile template from runpod.toml.
+func renderDockerfile(config *ProjectConfig, includeEnv bool) (string, error) {
+	if config.Project.BaseImage == "" {
+		return "", fmt.Errorf("%s is missing project.base_image", projectConfigFile)
+	}
+	if strings.ContainsAny(config.Project.BaseImage, " \t\n") {
+		return "", fmt.Errorf("invalid project.base_image %q", config.Project.BaseImage)
+	}
+	if !pythonVersionFormat.MatchString(config.Runtime.PythonVersion) {
+		return "", fmt.Errorf("invalid runtime.python_version %q, expected a version such as 3.10", config.Runtime.PythonVersion)
+	}
+
+	handlerPath, err := validateProjectFile(config, "runtime.handler_path", config.Runtime.HandlerPath)
+	if err != nil {
+		return "", err
+	}
+	requirementsPath, err := validateProjectFile(config, "runtime.requirements_path", config.Runtime.RequirementsPath)
+	if err != nil {
+		return "", err
+	}
+	if err := validateRuntimeSetup(config); err != nil {
+		return "", err
+	}
+
+	envLines := ""
+	if includeEnv {
+		if envLines, err = dockerfileEnvLines(config); err != nil {
+			return "", err
+		}
+	}
+
+	replacer := strings.NewReplacer(
+		"<<BASE_IMAGE>>", config.Project.BaseImage,
+		"<<REQUIREMENTS_PATH>>", requirementsPath,
+		"<<PYTHON_VERSION>>", config.Runtime.PythonVersion,
+		"<<HANDLER_PATH>>", handlerPath,
+		"<<SYSTEM_PACKAGES>>", dockerfileSystemPackages(config),
+		"<<BUILD_STEPS>>", dockerfileBuildSteps(config),
+		"<<SET_ENV_VARS>>", envLines,
+	)
+	return replacer.Replace(exampleDockerfile), nil
+}
+
+// validateProjectFile checks that a path from runpod.toml names a file inside
+// the project and returns it in the slash-separated form used in Dockerfiles.
+func validateProjectFile(config *ProjectConfig, key, p string) (string, error) {
+	if p == "" {
+		return "", fmt.Errorf("%s is missing %s", projectConfigFile, key)
+	}
+	if filepath.IsAbs(p) {
+		return "", fmt.Errorf("%s must be relative to the project folder, got %s", key, p)
+	}
+
+	cleaned := path.Clean(filepath.ToSlash(p))
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("%s %s is outside the project folder", key, p)
+	}
+	if strings.ContainsAny(cleaned, " \t\n") {
+		return "", fmt.Errorf("%s %q must not contain whitespace", key, p)
+	}
+
+	info, err := os.Stat(filepath.Join(config.Dir(), filepath.FromSlash(cleaned)))
+	if err != nil {
+		return "", fmt.Errorf("%s %s not found", key, p)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s %s is a directory", key, p)
+	}
+	return cleaned, nil
+}
+
+// dockerfileEnvLines returns ENV instructions for the image environment.
+func dockerfileEnvLines(config *ProjectConfig) (string, error) {
+	envVars, err := imageEnvVars(config)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, envVar := range envVars {
+		fmt.Fprintf(&b, "ENV %s=%s\n", envVar.Key, quoteDockerfileValue(envVar.Value))
+	}
+	return b.String(), nil
+}
+
+// imageEnvVars returns the literal values of project.env_vars. Values
+// resolved from the local machine and RunPod secret references are left out
+// so they are never baked into an image.
+func imageEnvVars(config *ProjectConfig) ([]EnvVar, error) {
+	envVars, err := resolveProjectEnv(config)
+	if err != nil {
+		return nil, err
+	}
+
+	literals := []EnvVar{}
+	for _, envVar := range envVars {
+		if !envKeyFormat.MatchString(envVar.Key) {
+			return nil, fmt.Errorf("invalid environment variable name %q", envVar.Key)
+		}
+		switch envVar.source {
+		case envLocal:
+			fmt.Printf("%sSkipping %s, values from the local environment, env_file or secrets are not written to the image\n", inputPromptPrefix, envVar.Key)
+			continue
+		case envSecret:
+			fmt.Printf("%sSkipping %s, RunPod secrets are set on the endpoint template\n", inputPromptPrefix, envVar.Key)
+			continue
+		}
+		literals = append(literals, envVar)
+	}
+	return literals, nil
+}
+
+// quoteDockerfileValue quotes a value for an ENV instruction, escaping the
+// characters Docker would otherwise interpret.
+func quoteDockerfileValue(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`).Replace(value)
+	return `"` + escaped + `"`
+}
+
+// writeGeneratedFile writes content to path unless the file already has that
+// content. Existing files without the generated marker are not overwritten.
+func writeGeneratedFile(path, content string) (bool, error) {
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	if err == nil {
+		if string(existing) == content {
+			return false, nil
+		}
+		if !strings.HasPrefix(string(existing), generatedDockerfileMarker) {
+			return false, fmt.Errorf("%s was not generated by airfoil build, remove it or choose another --output", path)
+		}
+	}
 
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return false, fmt.Errorf("writing %s: %w", path, err)
+	}
+	return true, nil
 }
@@ -0,0 +1,172 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// imageBuilder builds and pushes container images. Backends wrap a container
+// CLI; the executable can be replaced, which is how they are exercised with
+// a fake builder in tests.
+type imageBuilder interface {
+	Name() string
+	Build(options imageBuildOptions) error
+	Push(image string) error
+	// Exists reports whether the image is in the local image store.
+	Exists(image string) bool
+	// Tag adds target as another name for the local image source.
+	Tag(source, target string) error
+}
+
+type imageBuildOptions struct {
+	ContextDir string
+	Dockerfile string
+	Image      string
+	BuildArgs  map[string]string
+	// Secrets maps secret ids to their values. They are exposed to RUN
+	// instructions with --mount=type=secret,id=<id> and never stored in layers.
+	Secrets map[string]string
+}
+
+// supportedBuilders are the container CLIs build can drive, in the order
+// they are looked up on PATH.
+var supportedBuilders = []string{"docker", "podman", "nerdctl", "buildah"}
+
+// cliBuilder runs a docker compatible command line.
+type cliBuilder struct {
+	name       string
+	executable string
+}
+
+// newImageBuilder returns the builder backend called name, or the first one
+// found on PATH when name is empty. The executable can be overridden with
+// AIRFOIL_BUILDER_PATH or the builderPath config key.
+func newImageBuilder(name string) (imageBuilder, error) {
+	if name == "" {
+		name = viper.GetString("builder")
+	}
+
+	executable := os.Getenv("AIRFOIL_BUILDER_PATH")
+	if executable == "" {
+		executable = viper.GetString("builderPath")
+	}
+
+	if name == "" {
+		for _, candidate := range supportedBuilders {
+			if _, err := exec.LookPath(candidate); err == nil {
+				name = candidate
+				break
+			}
+		}
+		if name == "" && executable != "" {
+			name = "docker"
+		}
+		if name == "" {
+			return nil, fmt.Errorf("no container builder found, install one of %s", strings.Join(supportedBuilders, ", "))
+		}
+	}
+	if !contains(name, supportedBuilders) {
+		return nil, fmt.Errorf("unknown builder %q, use one of %s", name, strings.Join(supportedBuilders, ", "))
+	}
+
+	if executable == "" {
+		executable = name
+	}
+	path, err := exec.LookPath(executable)
+	if err != nil {
+		return nil, fmt.Errorf("builder %s not found: %w", name, err)
+	}
+	return &cliBuilder{name: name, executable: path}, nil
+}
+
+func (b *cliBuilder) Name() string {
+	return b.name
+}
+
+func (b *cliBuilder) Build(options imageBuildOptions) error {
+	if options.Image == "" {
+		return errors.New("no image tag to build")
+	}
+
+	// Secrets are passed as files so every backend can read them the same way.
+	secretsDir := ""
+	if len(options.Secrets) > 0 {
+		var err error
+		secretsDir, err = os.MkdirTemp("", "airfoil-secrets-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(secretsDir)
+	}
+
+	args := []string{"build"}
+	if b.name == "buildah" {
+		args = []string{"build", "--layers"}
+	}
+	args = append(args, "--tag", options.Image, "--file", options.Dockerfile)
+
+	for _, key := range sortedKeys(options.BuildArgs) {
+		args = append(args, "--build-arg", key+"="+options.BuildArgs[key])
+	}
+	for _, id := range sortedKeys(options.Secrets) {
+		secretPath := filepath.Join(secretsDir, id)
+		if err := os.WriteFile(secretPath, []byte(options.Secrets[id]), 0600); err != nil {
+			return err
+		}
+		args = append(args, "--secret", fmt.Sprintf("id=%s,src=%s", id, secretPath))
+	}
+	args = append(args, options.ContextDir)
+
+	cmd := exec.Command(b.executable, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// Build secrets need BuildKit with docker.
+	cmd.Env = append(os.Environ(), "DOCKER_BUILDKIT=1")
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s build: %w", b.name, err)
+	}
+	return nil
+}
+
+func (b *cliBuilder) Push(image string) error {
+	cmd := exec.Command(b.executable, "push", image)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s push: %w", b.name, err)
+	}
+	return nil
+}
+
+func (b *cliBuilder) Exists(image string) bool {
+	args := []string{"image", "inspect", image}
+	if b.name == "buildah" {
+		args = []string{"inspect", "--type", "image", image}
+	}
+	return exec.Command(b.executable, args...).Run() == nil
+}
+
+func (b *cliBuilder) Tag(source, target string) error {
+	cmd := exec.Command(b.executable, "tag", source, target)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s tag: %w", b.name, err)
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,202 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeBuilderScript records the arguments of every call in calls, one per
+// line and calls separated by "--", and copies the files passed as build
+// secrets to secret.<id> before the builder removes them. Images listed in
+// images exist.
+const fakeBuilderScript = `#!/bin/sh
+dir=$(dirname "$0")
+for arg; do echo "$arg"; done >> "$dir/calls"
+echo -- >> "$dir/calls"
+for arg; do
+	case "$arg" in
+	id=*,src=*)
+		id=${arg#id=}; id=${id%%,*}
+		cp "${arg#*,src=}" "$dir/secret.$id"
+		;;
+	esac
+done
+case "$1" in
+image|inspect)
+	for image; do :; done
+	grep -qx "$image" "$dir/images" 2>/dev/null
+	;;
+esac
+`
+
+// newFakeBuilder puts a fake name executable first on PATH and returns the
+// builder for it along with the directory the script records into.
+func newFakeBuilder(t *testing.T, name string) (imageBuilder, string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake builder is a shell script")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(fakeBuilderScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("AIRFOIL_BUILDER_PATH", "")
+
+	builder, err := newImageBuilder(name)
+	if err != nil {
+		t.Fatalf("newImageBuilder(%q): %v", name, err)
+	}
+	return builder, dir
+}
+
+// fakeBuilderCalls returns the argument lists the fake builder was run with.
+func fakeBuilderCalls(t *testing.T, dir string) [][]string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(dir, "calls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := [][]string{}
+	call := []string{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+		if line == "--" {
+			calls = append(calls, call)
+			call = []string{}
+			continue
+		}
+		call = append(call, line)
+	}
+	return calls
+}
+
+func TestCliBuilderBuild(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder string
+		options imageBuildOptions
+		want    []string
+	}{
+		{
+			name:    "docker",
+			builder: "docker",
+			options: imageBuildOptions{ContextDir: "/ctx", Dockerfile: "/ctx/Dockerfile", Image: "acme/worker:v1"},
+			want:    []string{"build", "--tag", "acme/worker:v1", "--file", "/ctx/Dockerfile", "/ctx"},
+		},
+		{
+			name:    "build arguments sorted",
+			builder: "podman",
+			options: imageBuildOptions{
+				ContextDir: "/ctx",
+				Dockerfile: "/ctx/Dockerfile",
+				Image:      "worker",
+				BuildArgs:  map[string]string{"MODEL": "gpt2", "BASE": "runpod/base"},
+			},
+			want: []string{"build", "--tag", "worker", "--file", "/ctx/Dockerfile",
+				"--build-arg", "BASE=runpod/base", "--build-arg", "MODEL=gpt2", "/ctx"},
+		},
+		{
+			name:    "buildah caches layers",
+			builder: "buildah",
+			options: imageBuildOptions{ContextDir: "/ctx", Dockerfile: "/ctx/Dockerfile", Image: "worker"},
+			want:    []string{"build", "--layers", "--tag", "worker", "--file", "/ctx/Dockerfile", "/ctx"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			builder, dir := newFakeBuilder(t, test.builder)
+			if err := builder.Build(test.options); err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+
+			calls := fakeBuilderCalls(t, dir)
+			if len(calls) != 1 || !reflect.DeepEqual(calls[0], test.want) {
+				t.Errorf("builder was run with %q, want %q", calls, [][]string{test.want})
+			}
+		})
+	}
+}
+
+func TestCliBuilderBuildSecrets(t *testing.T) {
+	builder, dir := newFakeBuilder(t, "docker")
+	err := builder.Build(imageBuildOptions{
+		ContextDir: "/ctx",
+		Dockerfile: "/ctx/Dockerfile",
+		Image:      "worker",
+		Secrets:    map[string]string{"HF_TOKEN": "hf_secret", "API_KEY": "key"},
+	})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	calls := fakeBuilderCalls(t, dir)
+	if len(calls) != 1 {
+		t.Fatalf("builder was run %d times, want once", len(calls))
+	}
+	secretPaths := map[string]string{}
+	args := calls[0]
+	for i, arg := range args {
+		if arg != "--secret" || i+1 == len(args) {
+			continue
+		}
+		id, src, _ := strings.Cut(strings.TrimPrefix(args[i+1], "id="), ",src=")
+		secretPaths[id] = src
+	}
+	if len(secretPaths) != 2 {
+		t.Fatalf("secrets passed as %q, want HF_TOKEN and API_KEY", args)
+	}
+
+	for id, want := range map[string]string{"HF_TOKEN": "hf_secret", "API_KEY": "key"} {
+		if strings.Contains(strings.Join(args, " "), want) {
+			t.Errorf("secret %s value is on the command line: %q", id, args)
+		}
+		content, err := os.ReadFile(filepath.Join(dir, "secret."+id))
+		if err != nil {
+			t.Errorf("secret %s was not readable by the builder: %v", id, err)
+			continue
+		}
+		if string(content) != want {
+			t.Errorf("secret %s file = %q, want %q", id, content, want)
+		}
+		if _, err := os.Stat(secretPaths[id]); !os.IsNotExist(err) {
+			t.Errorf("secret file %s was not removed after the build", secretPaths[id])
+		}
+	}
+}
+
+func TestCliBuilderPushTagExists(t *testing.T) {
+	builder, dir := newFakeBuilder(t, "docker")
+	if err := os.WriteFile(filepath.Join(dir, "images"), []byte("worker:v1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := builder.Push("registry.example.com/worker:v1"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if err := builder.Tag("worker:v1", "worker:v2"); err != nil {
+		t.Fatalf("Tag: %v", err)
+	}
+	if !builder.Exists("worker:v1") {
+		t.Error("Exists(worker:v1) = false, want true")
+	}
+	if builder.Exists("worker:v3") {
+		t.Error("Exists(worker:v3) = true, want false")
+	}
+
+	want := [][]string{
+		{"push", "registry.example.com/worker:v1"},
+		{"tag", "worker:v1", "worker:v2"},
+		{"image", "inspect", "worker:v1"},
+		{"image", "inspect", "worker:v3"},
+	}
+	if calls := fakeBuilderCalls(t, dir); !reflect.DeepEqual(calls, want) {
+		t.Errorf("builder was run with %q, want %q", calls, want)
+	}
+}
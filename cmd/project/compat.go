@@ -0,0 +1,141 @@
+package project
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// runtimeImage is a runpod/base image and the Python versions it ships.
+type runtimeImage struct {
+	CudaVersion    string
+	Image          string
+	PythonVersions []string
+}
+
+// runtimeMatrix lists the supported CUDA versions, newest first, with the
+// runpod/base image used for each and the Python versions it provides.
+var runtimeMatrix = []runtimeImage{
+	{CudaVersion: "12.5", Image: "runpod/base:0.6.1-cuda12.5.0", PythonVersions: []string{"3.12", "3.11", "3.10", "3.9", "3.8"}},
+	{CudaVersion: "12.4", Image: "runpod/base:0.6.1-cuda12.4.1", PythonVersions: []string{"3.12", "3.11", "3.10", "3.9", "3.8"}},
+	{CudaVersion: "12.1", Image: "runpod/base:0.6.1-cuda12.1.0", PythonVersions: []string{"3.11", "3.10", "3.9", "3.8"}},
+	{CudaVersion: "11.8", Image: "runpod/base:0.6.1-cuda11.8.0", PythonVersions: []string{"3.11", "3.10", "3.9", "3.8"}},
+}
+
+func supportedCudaVersions() []string {
+	versions := make([]string, 0, len(runtimeMatrix))
+	for _, image := range runtimeMatrix {
+		versions = append(versions, image.CudaVersion)
+	}
+	return versions
+}
+
+// supportedPythonVersions returns every Python version available with at
+// least one CUDA version, newest first.
+func supportedPythonVersions() []string {
+	versions := []string{}
+	for _, image := range runtimeMatrix {
+		for _, version := range image.PythonVersions {
+			if !contains(version, versions) {
+				versions = append(versions, version)
+			}
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versionLess(versions[j], versions[i]) })
+	return versions
+}
+
+func findRuntimeImage(cudaVersion string) (runtimeImage, bool) {
+	for _, image := range runtimeMatrix {
+		if image.CudaVersion == cudaVersion {
+			return image, true
+		}
+	}
+	return runtimeImage{}, false
+}
+
+// validateRuntime checks a CUDA and Python combination against the matrix
+// and suggests the closest supported alternatives when it is not available.
+func validateRuntime(cudaVersion, pythonVersion string) error {
+	image, ok := findRuntimeImage(cudaVersion)
+	if !ok {
+		return fmt.Errorf("unsupported CUDA version %q, use one of %s (closest is %s)",
+			cudaVersion, strings.Join(supportedCudaVersions(), ", "), closestVersion(cudaVersion, supportedCudaVersions()))
+	}
+
+	if contains(pythonVersion, image.PythonVersions) {
+		return nil
+	}
+
+	if !contains(pythonVersion, supportedPythonVersions()) {
+		return fmt.Errorf("unsupported Python version %q, use one of %s (closest with CUDA %s is %s)",
+			pythonVersion, strings.Join(supportedPythonVersions(), ", "), cudaVersion, closestVersion(pythonVersion, image.PythonVersions))
+	}
+
+	var cudaAlternatives []string
+	for _, other := range runtimeMatrix {
+		if contains(pythonVersion, other.PythonVersions) {
+			cudaAlternatives = append(cudaAlternatives, other.CudaVersion)
+		}
+	}
+	return fmt.Errorf("no base image has Python %s with CUDA %s, use Python %s or CUDA %s",
+		pythonVersion, cudaVersion, strings.Join(image.PythonVersions, ", "), strings.Join(cudaAlternatives, ", "))
+}
+
+// baseImageFor returns the runpod/base image for a CUDA version.
+func baseImageFor(cudaVersion string) (string, error) {
+	image, ok := findRuntimeImage(cudaVersion)
+	if !ok {
+		return "", validateRuntime(cudaVersion, "")
+	}
+	return image.Image, nil
+}
+
+// parseVersion splits a "major.minor" version into numbers.
+func parseVersion(version string) (int, int, bool) {
+	majorText, minorText, _ := strings.Cut(version, ".")
+	major, err := strconv.Atoi(majorText)
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err := strconv.Atoi(minorText)
+	if err != nil && minorText != "" {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+func versionLess(a, b string) bool {
+	aMajor, aMinor, _ := parseVersion(a)
+	bMajor, bMinor, _ := parseVersion(b)
+	if aMajor != bMajor {
+		return aMajor < bMajor
+	}
+	return aMinor < bMinor
+}
+
+// closestVersion returns the candidate nearest to version.
+func closestVersion(version string, candidates []string) string {
+	major, minor, ok := parseVersion(version)
+	if !ok || len(candidates) == 0 {
+		return strings.Join(candidates, " or ")
+	}
+
+	best, bestDistance := candidates[0], -1
+	for _, candidate := range candidates {
+		candidateMajor, candidateMinor, _ := parseVersion(candidate)
+		distance := abs(candidateMajor-major)*100 + abs(candidateMinor-minor)
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,122 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+const projectConfigFile string = "runpod.toml"
+
+type ProjectConfig struct {
+	Name     string           `toml:"name"`
+	Project  ProjectSettings  `toml:"project"`
+	Endpoint EndpointSettings `toml:"endpoint"`
+	Runtime  RuntimeSettings  `toml:"runtime"`
+	Template *TemplateRecord  `toml:"template"`
+
+	// dir is the directory runpod.toml was loaded from.
+	dir string
+}
+
+type ProjectSettings struct {
+	Uuid                string            `toml:"uuid"`
+	BaseImage           string            `toml:"base_image"`
+	GpuTypes            []string          `toml:"gpu_types"`
+	GpuCount            int               `toml:"gpu_count"`
+	VolumeMountPath     string            `toml:"volume_mount_path"`
+	Ports               string            `toml:"ports"`
+	ContainerDiskSizeGb int               `toml:"container_disk_size_gb"`
+	EnvFile             string            `toml:"env_file"`
+	EnvVars             map[string]string `toml:"env_vars"`
+}
+
+type EndpointSettings struct {
+	ActiveWorkers   int      `toml:"active_workers"`
+	MaxWorkers      int      `toml:"max_workers"`
+	Flashboot       bool     `toml:"flashboot"`
+	IdleTimeout     int      `toml:"idle_timeout"`
+	Locations       []string `toml:"locations"`
+	NetworkVolumeId string   `toml:"network_volume_id"`
+}
+
+type RuntimeSettings struct {
+	PythonVersion    string   `toml:"python_version"`
+	HandlerPath      string   `toml:"handler_path"`
+	RequirementsPath string   `toml:"requirements_path"`
+	SystemPackages   []string `toml:"system_packages"`
+	BuildSteps       []string `toml:"build_steps"`
+}
+
+// TemplateRecord remembers the starter template a project was created from
+// and the values it was rendered with, so it can be upgraded later.
+type TemplateRecord struct {
+	Name          string            `toml:"name"`
+	Source        string            `toml:"source"`
+	Version       string            `toml:"version"`
+	ModelName     string            `toml:"model_name"`
+	CudaVersion   string            `toml:"cuda_version"`
+	PythonVersion string            `toml:"python_version"`
+	Vars          map[string]string `toml:"vars"`
+}
+
+// loadProjectConfig reads runpod.toml from the current directory.
+func loadProjectConfig() (*ProjectConfig, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("getting current directory: %w", err)
+	}
+	return loadProjectConfigFrom(cwd)
+}
+
+// loadProjectConfigFrom reads runpod.toml from dir and fills in defaults for
+// keys that older project files may not define.
+func loadProjectConfigFrom(dir string) (*ProjectConfig, error) {
+	content, err := os.ReadFile(filepath.Join(dir, projectConfigFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no %s found in %s, run this command from a project folder", projectConfigFile, dir)
+		}
+		return nil, fmt.Errorf("reading %s: %w", projectConfigFile, err)
+	}
+
+	config := &ProjectConfig{dir: dir}
+	if err := toml.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", projectConfigFile, err)
+	}
+
+	if config.Name == "" {
+		return nil, fmt.Errorf("%s is missing the project name", projectConfigFile)
+	}
+	if config.Project.Uuid == "" {
+		return nil, fmt.Errorf("%s is missing project.uuid", projectConfigFile)
+	}
+	if config.Project.GpuCount == 0 {
+		config.Project.GpuCount = 1
+	}
+	if config.Project.VolumeMountPath == "" {
+		config.Project.VolumeMountPath = "/runpod-volume"
+	}
+	if config.Project.ContainerDiskSizeGb == 0 {
+		config.Project.ContainerDiskSizeGb = 100
+	}
+	if config.Endpoint.IdleTimeout == 0 {
+		config.Endpoint.IdleTimeout = 5
+	}
+	if config.Runtime.HandlerPath == "" {
+		config.Runtime.HandlerPath = "src/handler.py"
+	}
+	if config.Runtime.RequirementsPath == "" {
+		config.Runtime.RequirementsPath = "builder/requirements.txt"
+	}
+
+	return config, nil
+}
+
+// Dir returns the project directory.
+func (c *ProjectConfig) Dir() string {
+	return c.dir
+}
@@ -0,0 +1,332 @@
+package project
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// contextEpoch is the modification time of every entry of a build context
+// archive, so archives of the same files are byte for byte identical.
+var contextEpoch = time.Unix(0, 0).UTC()
+
+// contextEntry is a file, directory or symlink of the build context.
+type contextEntry struct {
+	Path   string
+	Mode   fs.FileMode
+	Target string
+}
+
+// buildContextSummary describes a written build context archive.
+type buildContextSummary struct {
+	Files    int
+	Bytes    int64
+	TarBytes int64
+	Digest   string
+}
+
+// collectBuildContext lists the entries of the project that go into the build
+// context, sorted by path, leaving out what EXCLUDE_PATTERNS, the env_file and
+// .runpodignore exclude.
+func collectBuildContext(config *ProjectConfig) ([]contextEntry, error) {
+	projectDir := config.Dir()
+	ignoreList, err := projectIgnoreList(config)
+	if err != nil {
+		return nil, fmt.Errorf("reading ignore list: %w", err)
+	}
+	matcher, err := newIgnoreMatcher(ignoreList)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []contextEntry{}
+	err = filepath.WalkDir(projectDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == projectDir {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(projectDir, p)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		if matcher.Match(relPath, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry := contextEntry{Path: relPath, Mode: info.Mode()}
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			if entry.Target, err = os.Readlink(p); err != nil {
+				return err
+			}
+		case !info.Mode().IsRegular() && !info.IsDir():
+			// Sockets, devices and pipes cannot be part of an image.
+			return nil
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("collecting build context: %w", err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// writeBuildContext writes a reproducible tar archive of the project to w:
+// entries are sorted, owned by root, have normalized permissions and a fixed
+// modification time. The generated Dockerfile is stored at the root of the
+// archive as "Dockerfile" so builders find it without extra flags.
+func writeBuildContext(w io.Writer, projectDir string, entries []contextEntry, dockerfile []byte) (*buildContextSummary, error) {
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(w, hash)}
+	tw := tar.NewWriter(counter)
+	summary := &buildContextSummary{}
+
+	writeHeader := func(header *tar.Header) error {
+		header.ModTime = contextEpoch
+		header.Uid, header.Gid = 0, 0
+		header.Uname, header.Gname = "", ""
+		header.Format = tar.FormatPAX
+		return tw.WriteHeader(header)
+	}
+
+	if dockerfile != nil {
+		if err := writeHeader(&tar.Header{Name: "Dockerfile", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(dockerfile))}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(dockerfile); err != nil {
+			return nil, err
+		}
+		summary.Files++
+		summary.Bytes += int64(len(dockerfile))
+	}
+
+	for _, entry := range entries {
+		if dockerfile != nil && entry.Path == "Dockerfile" {
+			continue
+		}
+
+		var err error
+		switch {
+		case entry.Mode.IsDir():
+			err = writeHeader(&tar.Header{Name: entry.Path + "/", Typeflag: tar.TypeDir, Mode: 0755})
+		case entry.Mode&fs.ModeSymlink != 0:
+			err = writeHeader(&tar.Header{Name: entry.Path, Typeflag: tar.TypeSymlink, Linkname: entry.Target, Mode: 0777})
+		default:
+			err = writeContextFile(tw, writeHeader, projectDir, entry, summary)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("archiving %s: %w", entry.Path, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	summary.TarBytes = counter.n
+	summary.Digest = "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	return summary, nil
+}
+
+func writeContextFile(tw *tar.Writer, writeHeader func(*tar.Header) error, projectDir string, entry contextEntry, summary *buildContextSummary) error {
+	file, err := os.Open(filepath.Join(projectDir, filepath.FromSlash(entry.Path)))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Keep only whether the file is executable.
+	mode := int64(0644)
+	if info.Mode()&0111 != 0 {
+		mode = 0755
+	}
+	if err := writeHeader(&tar.Header{Name: entry.Path, Typeflag: tar.TypeReg, Mode: mode, Size: info.Size()}); err != nil {
+		return err
+	}
+	written, err := io.Copy(tw, file)
+	if err != nil {
+		return err
+	}
+
+	summary.Files++
+	summary.Bytes += written
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// writeBuildContextFile writes the build context archive to path, gzipped
+// when the path ends in .gz or .tgz. The digest is always of the plain tar.
+func writeBuildContextFile(path string, config *ProjectConfig, dockerfile []byte) (*buildContextSummary, error) {
+	projectDir := config.Dir()
+	entries, err := collectBuildContext(config)
+	if err != nil {
+		return nil, err
+	}
+	// Never archive a previous copy of the archive itself.
+	if relPath, err := filepath.Rel(projectDir, path); err == nil {
+		relPath = filepath.ToSlash(relPath)
+		for i, entry := range entries {
+			if entry.Path == relPath {
+				entries = append(entries[:i], entries[i+1:]...)
+				break
+			}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".context-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var w io.Writer = tmp
+	var gz *gzip.Writer
+	if strings.HasSuffix(path, ".gz") || strings.HasSuffix(path, ".tgz") {
+		// A zero header keeps the compressed archive reproducible as well.
+		gz = gzip.NewWriter(tmp)
+		w = gz
+	}
+
+	summary, err := writeBuildContext(w, projectDir, entries, dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("writing %s: %w", path, err)
+	}
+	return summary, nil
+}
+
+// stageBuildContext writes the build context archive and unpacks it into
+// dir at the same time, so a builder sees exactly the archived files. It
+// returns the summary of the archive.
+func stageBuildContext(dir, projectDir string, entries []contextEntry, dockerfile []byte) (*buildContextSummary, error) {
+	reader, writer := io.Pipe()
+	var summary *buildContextSummary
+	go func() {
+		var err error
+		summary, err = writeBuildContext(writer, projectDir, entries, dockerfile)
+		writer.CloseWithError(err)
+	}()
+
+	err := extractBuildContext(reader, dir)
+	// Drain the pipe so the writer finishes even when extracting failed.
+	io.Copy(io.Discard, reader)
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// extractBuildContext unpacks a build context archive into dir.
+func extractBuildContext(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("archive entry %q leaves the build context", header.Name)
+		}
+		target := filepath.Join(dir, name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, fs.FileMode(header.Mode).Perm())
+		case tar.TypeSymlink:
+			err = os.Symlink(header.Linkname, target)
+		case tar.TypeReg:
+			err = extractContextFile(tr, target, fs.FileMode(header.Mode).Perm())
+		}
+		if err != nil {
+			return fmt.Errorf("extracting %s: %w", header.Name, err)
+		}
+	}
+}
+
+func extractContextFile(r io.Reader, target string, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// formatBytes formats a size for humans.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
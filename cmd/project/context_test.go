@@ -0,0 +1,85 @@
+package project
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestStageBuildContext(t *testing.T) {
+	projectDir := t.TempDir()
+	files := map[string]string{
+		"runpod.toml":              "name = \"worker\"\n",
+		"src/handler.py":           "print('hello')\n",
+		"Dockerfile":               "FROM scratch\n",
+		".env":                     "HF_TOKEN=hf_secret\n",
+		"config/local.env":         "API_KEY=key\n",
+		secretsFile:                "{}\n",
+		".runpod/state.json":       "{}\n",
+		"src/__pycache__/x.pyc":    "",
+		".runpodignore":            "README.md\n",
+		"README.md":                "# worker\n",
+		"builder/requirements.txt": "runpod\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(projectDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := &ProjectConfig{dir: projectDir}
+	config.Project.EnvFile = "config/local.env"
+	entries, err := collectBuildContext(config)
+	if err != nil {
+		t.Fatalf("collectBuildContext: %v", err)
+	}
+
+	dockerfile := []byte("FROM runpod/base\nADD . /\n")
+	contextDir := t.TempDir()
+	staged, err := stageBuildContext(contextDir, projectDir, entries, dockerfile)
+	if err != nil {
+		t.Fatalf("stageBuildContext: %v", err)
+	}
+
+	stagedFiles := []string{}
+	err = filepath.WalkDir(contextDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(contextDir, path)
+		stagedFiles = append(stagedFiles, filepath.ToSlash(relPath))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(stagedFiles)
+	want := []string{".runpodignore", "Dockerfile", "builder/requirements.txt", "runpod.toml", "src/handler.py"}
+	if !reflect.DeepEqual(stagedFiles, want) {
+		t.Errorf("staged files = %q, want %q", stagedFiles, want)
+	}
+
+	content, err := os.ReadFile(filepath.Join(contextDir, "Dockerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != string(dockerfile) {
+		t.Errorf("staged Dockerfile = %q, want the generated one", content)
+	}
+
+	// The staged files are the ones the content hash is computed from.
+	summary, err := writeBuildContext(io.Discard, projectDir, entries, dockerfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if staged.Digest != summary.Digest {
+		t.Errorf("staged context digest %s, want %s", staged.Digest, summary.Digest)
+	}
+}
@@ -1,14 +1,17 @@
 package project
 
 import (
+	"bytes"
 	"fmt"
 	"os"
-
-	tea "github.com/charmbracelet/bubbletea"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
+var answersFile string
+
 var NewProjectCmd = &cobra.Command{
 	Use:     "create",
 	Aliases: []string{"new"},
@@ -18,30 +21,134 @@ This command will guide you through the process of setting up a new project,
 including selecting a starter template, choosing CUDA and Python versions,
 and configuring other project settings.`,
 	Example: `  airfoil create --name my-project
-  airfoil create --name my-llm-project --type LLM --model gpt2`,
+  airfoil create --yes --name my-project --type Hello_World --cuda 12.4 --python 3.11
+  airfoil create --answers answers.yaml
+  airfoil create --name my-llm-project --type LLM --model gpt2
+  airfoil create --name my-handler --template https://github.com/acme/handler-template.git#v1`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if projectName == "" || modelType == "" || modelName == "" {
+		if initCurrentDir {
+			name := ""
+			if cmd.Flags().Changed("name") {
+				name = projectName
+			}
+			if err := initProject(name, cudaVersion); err != nil {
+				fmt.Println("Failed to initialize project:", err)
+				os.Exit(1)
+			}
+			return
+		}
 
-			m := initialModel()
-			p := tea.NewProgram(m)
-			if _, err := p.Run(); err != nil {
-				fmt.Println("Failed to create project structure")
+		variables, err := parseTemplateVariables(templateVariables)
+		if err != nil {
+			fmt.Println("Failed to create project:", err)
+			os.Exit(1)
+		}
+
+		answers := &createAnswers{
+			ProjectName:   projectName,
+			TemplateRef:   modelType,
+			ModelName:     modelName,
+			CudaVersion:   cudaVersion,
+			PythonVersion: pythonVersion,
+			Variables:     variables,
+		}
+		if templateSource != "" {
+			answers.TemplateRef = templateSource
+		}
+
+		if answersFile != "" {
+			if err := mergeAnswersFile(cmd, answers, answersFile); err != nil {
+				fmt.Println("Failed to create project:", err)
 				os.Exit(1)
 			}
-		} else {
-			createProjectStructure(projectName, modelType, modelName, cudaVersion, pythonVersion)
-			fmt.Println("Project created successfully")
+		}
 
+		if err := validateRuntime(answers.CudaVersion, answers.PythonVersion); err != nil {
+			fmt.Println("Failed to create project:", err)
+			os.Exit(1)
 		}
 
+		nonInteractive := assumeYes || answersFile != ""
+		if !nonInteractive && (answers.ProjectName == "" || answers.TemplateRef == "") {
+			answers, err = runCreateWizard(*answers)
+			if err != nil {
+				fmt.Println("Failed to run the create wizard:", err)
+				os.Exit(1)
+			}
+			if answers == nil {
+				fmt.Println("Project creation cancelled")
+				return
+			}
+		}
+
+		if err := createNewProject(answers.ProjectName, answers.TemplateRef, answers.ModelName, answers.CudaVersion, answers.PythonVersion, answers.Variables); err != nil {
+			fmt.Println("Failed to create project:", err)
+			os.Exit(1)
+		}
 	},
 }
 
 func init() {
+	NewProjectCmd.Long += starterTemplateHelp()
+
 	NewProjectCmd.Flags().StringVarP(&projectName, "name", "n", "hello-world", "Set the project name, a directory with this name will be created in the current path")
-	NewProjectCmd.Flags().StringVarP(&modelType, "type", "t", "", "Specify the model type for the project")
-	NewProjectCmd.Flags().StringVarP(&modelName, "model", "m", "", "Specify the Hugging Face model name for the project")
+	NewProjectCmd.Flags().StringVarP(&modelType, "type", "t", "", "Specify the starter template for the project: "+strings.Join(starterTemplateNames(), ", "))
+	NewProjectCmd.Flags().StringVarP(&modelName, "model", "m", "", "Specify the Hugging Face model name for the project (defaults to the starter template's model)")
 	NewProjectCmd.Flags().StringVarP(&cudaVersion, "cuda", "c", "12.5", "Specify the CUDA version for the project")
 	NewProjectCmd.Flags().StringVarP(&pythonVersion, "python", "p", "3.10", "Specify the Python version for the project")
-	NewProjectCmd.Flags().BoolVarP(&initCurrentDir, "init", "i", false, "Initialize the project in the current directory instead of creating a new one")
+	NewProjectCmd.Flags().StringVar(&templateSource, "template", "", "Use a starter template from a local directory, tarball, git URL (with optional #ref) or configured source instead of --type")
+	NewProjectCmd.Flags().BoolVar(&refreshTemplate, "refresh-template", false, "Fetch the --template source again even if it is cached")
+	NewProjectCmd.Flags().StringArrayVar(&templateVariables, "var", nil, "Set a starter template variable as NAME=VALUE, the variables of each template are listed above")
+	NewProjectCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Never start the interactive wizard, use defaults for anything not given as a flag")
+	NewProjectCmd.Flags().StringVar(&answersFile, "answers", "", "Read the project settings from a YAML answers file and run non-interactively; flags override its values")
+	NewProjectCmd.Flags().BoolVarP(&initCurrentDir, "init", "i", false, "Adopt the existing code in the current directory instead of creating a new one, same as 'airfoil init'")
+}
+
+// mergeAnswersFile fills answers from a YAML answers file such as
+//
+//	name: my-project
+//	template: LLM
+//	model: google/flan-t5-base
+//	cuda: "12.4"
+//	python: "3.11"
+//	vars:
+//	  MAX_NEW_TOKENS: "256"
+//
+// Values given explicitly as flags take precedence over the file.
+func mergeAnswersFile(cmd *cobra.Command, answers *createAnswers, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading answers file: %w", err)
+	}
+
+	var fileAnswers createAnswers
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&fileAnswers); err != nil {
+		return fmt.Errorf("parsing answers file %s: %w", path, err)
+	}
+
+	flags := cmd.Flags()
+	if fileAnswers.ProjectName != "" && !flags.Changed("name") {
+		answers.ProjectName = fileAnswers.ProjectName
+	}
+	if fileAnswers.TemplateRef != "" && !flags.Changed("type") && !flags.Changed("template") {
+		answers.TemplateRef = fileAnswers.TemplateRef
+	}
+	if fileAnswers.ModelName != "" && !flags.Changed("model") {
+		answers.ModelName = fileAnswers.ModelName
+	}
+	if fileAnswers.CudaVersion != "" && !flags.Changed("cuda") {
+		answers.CudaVersion = fileAnswers.CudaVersion
+	}
+	if fileAnswers.PythonVersion != "" && !flags.Changed("python") {
+		answers.PythonVersion = fileAnswers.PythonVersion
+	}
+	for name, value := range fileAnswers.Variables {
+		if _, ok := answers.Variables[name]; !ok {
+			answers.Variables[name] = value
+		}
+	}
+
+	return nil
 }
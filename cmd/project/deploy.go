@@ -1,17 +1,349 @@
 package project
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/spf13/cobra"
+	"github.com/yourusername/airfoil/api"
+)
+
+var (
+	deployImageName string
+	deployPlanOnly  bool
 )
 
 var DeployProjectCmd = &cobra.Command{
 	Use:   "deploy",
 	Short: "Deploys your project as an endpoint",
-	Long:  "Deploys a serverless endpoint for the RunPod project in the current folder",
+	Long: `Deploys a serverless endpoint for the RunPod project in the current folder.
+A serverless template is created from the pushed image and the env_vars in runpod.toml,
+and the endpoint is created from the [endpoint] settings. Later deploys create a new
+template and switch the same endpoint over to it.
+
+The image defaults to the last one built and pushed with 'airfoil build --push' or
+'airfoil image push', pinned to its digest when known.`,
+	Example: `  airfoil build --push --tag registry.example.com/acme/my-worker:v1 && airfoil deploy
+  airfoil deploy --image registry.example.com/acme/my-worker:v2`,
+	Args: cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Deploying project...")
-		// Implement the logic for deploying a project here
+		if err := deployProject(); err != nil {
+			if errors.Is(err, errChangesPending) {
+				os.Exit(2)
+			}
+			fmt.Println("Failed to deploy project:", err)
+			os.Exit(1)
+		}
 	},
 }
+
+func init() {
+	addEnvironmentFlag(DeployProjectCmd)
+	DeployProjectCmd.Flags().StringVar(&deployImageName, "image", "", "Image to deploy (default is the last pushed image)")
+	DeployProjectCmd.Flags().BoolVar(&deployPlanOnly, "plan", false, "Only show the changes deploy would make, exiting with status 2 when there are any")
+	DeployProjectCmd.Flags().StringVar(&deployStrategy, "strategy", strategyInPlace, "Deploy strategy: in-place, blue-green or canary")
+	DeployProjectCmd.Flags().BoolVar(&skipSmokeTest, "skip-smoke-test", false, "Do not run "+smokeTestInputFile+" against the new deploy")
+	DeployProjectCmd.Flags().DurationVar(&smokeTestTimeout, "smoke-timeout", 10*time.Minute, "How long the smoke test job may take to complete")
+	DeployProjectCmd.Flags().BoolVar(&allowDirty, "allow-dirty", false, "Deploy an image built from uncommitted changes")
+	DeployProjectCmd.Flags().BoolVar(&tagRelease, "tag-release", false, "Create a git tag for successful deploys to the production environment")
+}
+
+func deployProject() error {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	state, err := loadProjectState(config)
+	if err != nil {
+		return err
+	}
+	if err := validateDeployStrategy(); err != nil {
+		return err
+	}
+	smokeInput, err := readSmokeTestInput(config)
+	if err != nil {
+		return err
+	}
+
+	plan, err := planDeploy(config, state)
+	if err != nil {
+		return err
+	}
+	plan.print()
+	if deployPlanOnly {
+		if plan.pending() {
+			return errChangesPending
+		}
+		return nil
+	}
+	if !plan.pending() {
+		return nil
+	}
+	if err := checkGitRevision(plan.Revision, state.environment); err != nil {
+		return err
+	}
+
+	switch deployStrategy {
+	case strategyBlueGreen:
+		err = deployBlueGreen(config, state, plan, smokeInput)
+	case strategyCanary:
+		if tagRelease {
+			fmt.Println("A canary is tagged when it is promoted with airfoil deploy promote --tag-release")
+		}
+		return deployCanary(config, state, plan, smokeInput)
+	default:
+		err = deployInPlace(config, state, plan, smokeInput)
+	}
+	if err != nil {
+		return err
+	}
+	return tagDeployRelease(state)
+}
+
+// createProjectTemplate creates the serverless template for the plan and
+// returns its id and name.
+func createProjectTemplate(config *ProjectConfig, plan *deployPlan) (string, string, error) {
+	fmt.Printf("Creating template for %s\n", plan.Image)
+	// Template names must be unique, so every deploy gets a new one. The
+	// commit, when known, tells in the console which code a template runs.
+	label := time.Now().UTC().Format("20060102-150405") + "-" + uuid.New().String()[0:4]
+	if short := plan.Revision.ShortCommit(); short != "" {
+		label = short + "-" + label
+	}
+	templateName := environmentResourceName(config, label)
+	templateId, err := api.CreateTemplate(&api.CreateTemplateInput{
+		Name:              templateName,
+		ImageName:         plan.Image,
+		ContainerDiskInGb: config.Project.ContainerDiskSizeGb,
+		VolumeMountPath:   config.Project.VolumeMountPath,
+		Env:               toApiEnv(plan.EnvVars),
+		IsServerless:      true,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("creating template: %w", err)
+	}
+	return templateId, templateName, nil
+}
+
+// applyToStable points the stable endpoint of the environment at templateId
+// and applies the endpoint settings of the plan, creating the endpoint when
+// it does not exist yet. The state is updated but not saved.
+func applyToStable(config *ProjectConfig, state *ProjectState, plan *deployPlan, templateId, templateName, image string) (*api.Endpoint, error) {
+	endpoint := plan.Endpoint
+	input := *plan.Input
+	input.TemplateId = templateId
+	switch {
+	case endpoint == nil:
+		fmt.Printf("Creating endpoint %s\n", input.Name)
+		endpointId, err := api.CreateEndpoint(&input)
+		if err != nil {
+			return nil, fmt.Errorf("creating endpoint: %w", err)
+		}
+		endpoint = &api.Endpoint{Id: endpointId, Name: input.Name}
+	case len(plan.EndpointChanges) > 0:
+		fmt.Printf("Updating endpoint %s\n", endpoint.Id)
+		input.Id = endpoint.Id
+		if _, err := api.CreateEndpoint(&input); err != nil {
+			return nil, fmt.Errorf("updating endpoint %s: %w", endpoint.Id, err)
+		}
+		endpoint.Name = input.Name
+	default:
+		fmt.Printf("Updating endpoint %s to template %s\n", endpoint.Id, templateId)
+		if err := api.UpdateEndpointTemplate(endpoint.Id, templateId); err != nil {
+			return nil, fmt.Errorf("updating endpoint %s: %w", endpoint.Id, err)
+		}
+	}
+
+	state.Endpoint = &EndpointState{
+		Id:           endpoint.Id,
+		Name:         endpoint.Name,
+		TemplateId:   templateId,
+		TemplateName: templateName,
+		Image:        image,
+		DeployedAt:   time.Now().UTC(),
+		gitRevision:  plan.Revision,
+	}
+	state.recordDeploy(newDeployRecord(plan.Revision, endpoint.Id, templateId, templateName, image))
+	return endpoint, nil
+}
+
+// deployInPlace switches the stable endpoint to the new template, then runs
+// the smoke test against it. When the smoke test fails, the endpoint is
+// pointed back to its previous template and the new one is removed.
+func deployInPlace(config *ProjectConfig, state *ProjectState, plan *deployPlan, smokeInput []byte) error {
+	templateId, templateName, image := "", "", plan.Image
+	if plan.Endpoint != nil {
+		templateId = plan.Endpoint.TemplateId
+		if state.Endpoint != nil && state.Endpoint.TemplateId == templateId {
+			templateName, image = state.Endpoint.TemplateName, state.Endpoint.Image
+		}
+	}
+	previousTemplateId := templateId
+	previousEndpoint := state.Endpoint
+
+	templateChanged := plan.Endpoint == nil || len(plan.TemplateChanges) > 0
+	if templateChanged {
+		var err error
+		if templateId, templateName, err = createProjectTemplate(config, plan); err != nil {
+			return err
+		}
+		image = plan.Image
+	}
+
+	endpoint, err := applyToStable(config, state, plan, templateId, templateName, image)
+	if err != nil {
+		return err
+	}
+
+	if templateChanged {
+		if err := runSmokeTest(endpoint.Id, smokeInput); err != nil {
+			if previousTemplateId == "" {
+				return saveAfterFailure(state, err)
+			}
+			fmt.Printf("Rolling endpoint %s back to template %s\n", endpoint.Id, previousTemplateId)
+			if rollbackErr := api.UpdateEndpointTemplate(endpoint.Id, previousTemplateId); rollbackErr != nil {
+				return saveAfterFailure(state, fmt.Errorf("%w, and rolling back failed: %v", err, rollbackErr))
+			}
+			removeUnusedTemplate(templateName)
+			state.History = state.History[:len(state.History)-1]
+			state.Endpoint = previousEndpoint
+			return saveAfterFailure(state, err)
+		}
+	}
+
+	if err := state.save(); err != nil {
+		return err
+	}
+	printDeployed(image, endpoint.Id)
+	return nil
+}
+
+// saveAfterFailure records the endpoint a failed deploy left behind and
+// returns err, along with the save error when the state could not be written.
+func saveAfterFailure(state *ProjectState, err error) error {
+	if saveErr := state.save(); saveErr != nil {
+		return fmt.Errorf("%w, and saving the project state failed: %v", err, saveErr)
+	}
+	return err
+}
+
+func printDeployed(image, endpointId string) {
+	fmt.Printf("Deployed %s to endpoint %s\n", image, endpointId)
+	fmt.Printf("%shttps://api.runpod.ai/v2/%s/runsync\n", inputPromptPrefix, endpointId)
+}
+
+// validateEndpointSettings checks the [endpoint] section and the GPU list.
+func validateEndpointSettings(config *ProjectConfig) error {
+	if len(config.Project.GpuTypes) == 0 {
+		return fmt.Errorf("%s is missing project.gpu_types", projectConfigFile)
+	}
+	resolved, err := loadGpuCatalog().resolve(config.Project.GpuTypes)
+	if err != nil {
+		return err
+	}
+	for _, gpu := range resolved {
+		if gpu.Pool == "" {
+			fmt.Printf("%s is not available for serverless endpoints, skipping it\n", gpu.Id)
+		}
+	}
+	if _, err := endpointGpuIds(config); err != nil {
+		return err
+	}
+	if config.Endpoint.ActiveWorkers < 0 {
+		return errors.New("endpoint.active_workers must not be negative")
+	}
+	if config.Endpoint.MaxWorkers < 1 {
+		return errors.New("endpoint.max_workers must be at least 1")
+	}
+	if config.Endpoint.IdleTimeout < 1 {
+		return errors.New("endpoint.idle_timeout must be at least 1 second")
+	}
+	if config.Endpoint.ActiveWorkers > config.Endpoint.MaxWorkers {
+		return fmt.Errorf("endpoint.active_workers (%d) must not exceed endpoint.max_workers (%d)", config.Endpoint.ActiveWorkers, config.Endpoint.MaxWorkers)
+	}
+	return nil
+}
+
+// deployImage returns the image to deploy: --image, or the last pushed image.
+func deployImage(state *ProjectState) (string, error) {
+	if deployImageName != "" {
+		return deployImageName, nil
+	}
+	if state.Image == nil {
+		return "", errors.New("no image built yet, run airfoil build --push or pass --image")
+	}
+	if !state.Image.Pushed {
+		return "", fmt.Errorf("image %s has not been pushed, run airfoil build --push or airfoil image push", state.Image.Tag)
+	}
+	return state.Image.Reference(), nil
+}
+
+// imageRevision returns the git checkout the image was built from, when it
+// is the last image airfoil built for the project. Deploys record it rather
+// than the checkout at deploy time, which may have moved on since the build.
+func imageRevision(state *ProjectState, image string) gitRevision {
+	if state.Image == nil || (image != state.Image.Reference() && image != state.Image.Tag) {
+		return gitRevision{}
+	}
+	return state.Image.gitRevision
+}
+
+// projectEndpointName is the name of an endpoint of the project, kind being
+// "endpoint" for the stable one. RunPod enables FlashBoot for endpoints whose
+// name ends in -fb.
+func projectEndpointName(config *ProjectConfig, kind string) string {
+	name := environmentResourceName(config, kind)
+	if config.Endpoint.Flashboot {
+		name += "-fb"
+	}
+	return name
+}
+
+func projectEndpointInput(config *ProjectConfig, templateId string) (*api.CreateEndpointInput, error) {
+	gpuIds, err := endpointGpuIds(config)
+	if err != nil {
+		return nil, err
+	}
+	return &api.CreateEndpointInput{
+		Name:            projectEndpointName(config, "endpoint"),
+		TemplateId:      templateId,
+		GpuIds:          gpuIds,
+		NetworkVolumeId: config.Endpoint.NetworkVolumeId,
+		Locations:       strings.Join(config.Endpoint.Locations, ","),
+		IdleTimeout:     config.Endpoint.IdleTimeout,
+		ScalerType:      "QUEUE_DELAY",
+		ScalerValue:     4,
+		WorkersMin:      config.Endpoint.ActiveWorkers,
+		WorkersMax:      config.Endpoint.MaxWorkers,
+	}, nil
+}
+
+// findProjectEndpoint returns the endpoint of the environment, looked up by
+// the id recorded in the state and then by name, or nil when the environment
+// has not been deployed.
+func findProjectEndpoint(config *ProjectConfig, state *ProjectState) (*api.Endpoint, error) {
+	endpoints, err := api.GetEndpoints()
+	if err != nil {
+		return nil, fmt.Errorf("getting endpoints: %w", err)
+	}
+
+	if state.Endpoint != nil {
+		for _, endpoint := range endpoints {
+			if endpoint.Id == state.Endpoint.Id {
+				return endpoint, nil
+			}
+		}
+	}
+	endpointName := environmentResourceName(config, "endpoint")
+	for _, endpoint := range endpoints {
+		if strings.TrimSuffix(endpoint.Name, "-fb") == endpointName {
+			return endpoint, nil
+		}
+	}
+	return nil, nil
+}
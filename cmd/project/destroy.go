@@ -0,0 +1,253 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/yourusername/airfoil/api"
+	"github.com/yourusername/airfoil/format"
+)
+
+var includeVolumes bool
+
+var DestroyProjectCmd = &cobra.Command{
+	Use:   "destroy",
+	Short: "Remove the pods, endpoints and templates created for the project",
+	Long: `Removes the development pods, endpoints and templates of every environment of the
+project in the current folder. They are found through ` + projectStateFile + ` and the project
+uuid that airfoil adds to the name of everything it creates. The resources are listed first,
+and the project name must be typed to confirm. Network volumes are kept unless
+--include-volumes is passed, and always when an endpoint of another project uses them.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := destroyProject(); err != nil {
+			fmt.Println("Failed to destroy project:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	DestroyProjectCmd.Flags().BoolVar(&includeVolumes, "include-volumes", false, "Also delete the network volumes used by the project")
+}
+
+// projectResource is a remote resource that destroy removes.
+type projectResource struct {
+	Kind string
+	Id   string
+	Name string
+
+	// warning is shown under the list of resources before confirming.
+	warning string
+	remove  func() error
+}
+
+// findProjectResources lists the resources of the project: those recorded
+// in the state of any environment, and those named after the project uuid.
+// Pods go first and templates after the endpoints that use them.
+func findProjectResources(config *ProjectConfig, entry *projectStateEntry) ([]*projectResource, error) {
+	pods, err := api.GetPods()
+	if err != nil {
+		return nil, fmt.Errorf("getting pods: %w", err)
+	}
+	endpoints, err := api.GetEndpoints()
+	if err != nil {
+		return nil, fmt.Errorf("getting endpoints: %w", err)
+	}
+	templates, err := api.GetTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("getting templates: %w", err)
+	}
+
+	tag := fmt.Sprintf("(%s)", config.Project.Uuid)
+	ids := map[string]bool{}
+	if entry != nil {
+		for _, env := range entry.Environments {
+			if env.Pod != nil {
+				ids[env.Pod.Id] = true
+			}
+			for _, endpoint := range []*EndpointState{env.Endpoint, env.Canary} {
+				if endpoint != nil {
+					ids[endpoint.Id], ids[endpoint.TemplateId] = true, true
+				}
+			}
+			for _, record := range env.History {
+				ids[record.TemplateId] = true
+			}
+		}
+	}
+
+	resources := []*projectResource{}
+	otherPods := false
+	for _, pod := range pods {
+		if !ids[pod.Id] && !strings.HasSuffix(pod.Name, tag) {
+			otherPods = true
+		}
+		if ids[pod.Id] || strings.HasSuffix(pod.Name, tag) {
+			id := pod.Id
+			resources = append(resources, &projectResource{Kind: "pod", Id: id, Name: pod.Name, remove: func() error {
+				_, err := api.RemovePod(id)
+				return err
+			}})
+		}
+	}
+
+	// Templates and network volumes still used by an endpoint of another
+	// project are kept.
+	inUse := map[string]bool{}
+	volumeUsers := map[string]string{}
+	for _, endpoint := range endpoints {
+		if !ids[endpoint.Id] && !strings.HasSuffix(strings.TrimSuffix(endpoint.Name, "-fb"), tag) {
+			inUse[endpoint.TemplateId] = true
+			if endpoint.NetworkVolumeId != "" {
+				volumeUsers[endpoint.NetworkVolumeId] = endpoint.Name
+			}
+			continue
+		}
+		id, name, templateId := endpoint.Id, endpoint.Name, endpoint.TemplateId
+		resources = append(resources, &projectResource{Kind: "endpoint", Id: id, Name: name, remove: func() error {
+			return deleteProjectEndpoint(config, id, name, templateId)
+		}})
+	}
+	for _, template := range templates {
+		if inUse[template.Id] || !(ids[template.Id] || strings.HasSuffix(template.Name, tag)) {
+			continue
+		}
+		name := template.Name
+		resources = append(resources, &projectResource{Kind: "template", Id: template.Id, Name: name, remove: func() error {
+			return api.DeleteTemplate(name)
+		}})
+	}
+
+	if includeVolumes && entry != nil {
+		seen := map[string]bool{}
+		for _, env := range entry.Environments {
+			volume := env.NetworkVolume
+			if volume == nil || seen[volume.Id] {
+				continue
+			}
+			seen[volume.Id] = true
+			if user, ok := volumeUsers[volume.Id]; ok {
+				fmt.Printf("Keeping network volume %s, endpoint %s of another project uses it\n", volume.Id, user)
+				continue
+			}
+			id := volume.Id
+			resource := &projectResource{Kind: "network volume", Id: id, Name: volume.Name, remove: func() error {
+				return api.DeleteNetworkVolume(id)
+			}}
+			// Pods do not report the network volume they mount, so other
+			// pods can only be warned about.
+			if otherPods {
+				resource.warning = fmt.Sprintf("pods of other projects are running and may mount network volume %s, make sure none of them uses it", id)
+			}
+			resources = append(resources, resource)
+		}
+	}
+	return resources, nil
+}
+
+func destroyProject() error {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	file, err := readStateFile(config.Dir())
+	if err != nil {
+		return err
+	}
+	entry := file.Projects[config.Project.Uuid]
+
+	resources, err := findProjectResources(config, entry)
+	if err != nil {
+		return err
+	}
+	if len(resources) == 0 {
+		fmt.Printf("No resources found for %s (%s)\n", config.Name, config.Project.Uuid)
+		return nil
+	}
+
+	fmt.Printf("The following resources of %s (%s) will be removed:\n\n", config.Name, config.Project.Uuid)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Resource", "Id", "Name"})
+	format.TableDefaults(table)
+	for _, resource := range resources {
+		table.Append([]string{resource.Kind, resource.Id, resource.Name})
+	}
+	table.Render()
+	fmt.Println()
+	for _, resource := range resources {
+		if resource.warning != "" {
+			fmt.Printf("Warning: %s.\n", resource.warning)
+		}
+	}
+	if !includeVolumes && entry != nil {
+		for _, env := range entry.Environments {
+			if env.NetworkVolume != nil {
+				fmt.Println("Network volumes are kept, pass --include-volumes to delete them too.")
+				break
+			}
+		}
+	}
+
+	confirm := promptui.Prompt{
+		Label: fmt.Sprintf("Type the project name (%s) to confirm", config.Name),
+	}
+	answer, err := confirm.Run()
+	if err != nil || strings.TrimSpace(answer) != config.Name {
+		fmt.Println("Nothing was removed.")
+		return nil
+	}
+
+	removed := map[string]bool{}
+	failed := 0
+	for _, resource := range resources {
+		fmt.Printf("Removing %s %s\n", resource.Kind, resource.Id)
+		if err := resource.remove(); err != nil {
+			fmt.Printf("%sFailed: %s\n", inputPromptPrefix, err)
+			failed++
+			continue
+		}
+		removed[resource.Id] = true
+	}
+
+	if err := forgetDestroyedResources(config, removed); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d resources could not be removed, run airfoil destroy again", failed, len(resources))
+	}
+	fmt.Printf("Destroyed %s\n", config.Name)
+	return nil
+}
+
+// forgetDestroyedResources removes the removed resources from the state of
+// every environment. An environment whose endpoint is gone also loses its
+// deploy history, as the templates it points to are gone too.
+func forgetDestroyedResources(config *ProjectConfig, removed map[string]bool) error {
+	return updateStateFile(config.Dir(), func(file *stateFile) error {
+		entry := file.Projects[config.Project.Uuid]
+		if entry == nil {
+			return nil
+		}
+		for _, env := range entry.Environments {
+			if env.Pod != nil && removed[env.Pod.Id] {
+				env.Pod = nil
+			}
+			if env.Endpoint != nil && removed[env.Endpoint.Id] {
+				env.Endpoint, env.History = nil, nil
+			}
+			if env.Canary != nil && removed[env.Canary.Id] {
+				env.Canary = nil
+			}
+			if env.NetworkVolume != nil && removed[env.NetworkVolume.Id] {
+				env.NetworkVolume = nil
+			}
+		}
+		pruneStateFile(file)
+		return nil
+	})
+}
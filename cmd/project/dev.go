@@ -1,9 +1,15 @@
 package project
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/yourusername/airfoil/api"
 )
 
 var StartProjectCmd = &cobra.Command{
@@ -13,11 +19,210 @@ var StartProjectCmd = &cobra.Command{
 	Long:    "This command establishes a connection between your local development environment and your RunPod project environment, allowing for real-time synchronization of changes.",
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Starting a development session...")
-		// Implement the logic for starting a project here
+
+		if err := startProject(); err != nil {
+			fmt.Println("Error starting development session:", err)
+			os.Exit(1)
+		}
 	},
 }
 
 func init() {
 	StartProjectCmd.Flags().BoolVar(&setDefaultNetworkVolume, "select-volume", false, "Choose a new default network volume for the project")
+	addEnvironmentFlag(StartProjectCmd)
 	StartProjectCmd.Flags().BoolVar(&showPrefixInPodLogs, "prefix-pod-logs", true, "Include the Pod ID as a prefix in log messages from the project Pod")
 }
+
+func startProject() error {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	if err := validateRuntimeSetup(config); err != nil {
+		return err
+	}
+
+	envVars, err := resolveProjectEnv(config)
+	if err != nil {
+		return err
+	}
+
+	state, err := loadProjectState(config)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Checking for existing project pod...")
+	podId, err := getProjectPod(config, state)
+	if err != nil {
+		return err
+	}
+
+	if podId == "" {
+		if state.NetworkVolume == nil || setDefaultNetworkVolume {
+			networkVolume, err := selectNetworkVolume()
+			if err != nil {
+				return err
+			}
+			state.NetworkVolume = &NetworkVolumeState{Id: networkVolume.Id, Name: networkVolume.Name, DataCenterId: networkVolume.DataCenterId}
+		} else {
+			fmt.Printf("Using network volume %s (%s), choose another with --select-volume\n", state.NetworkVolume.Name, state.NetworkVolume.Id)
+		}
+
+		podId, err = launchDevPod(config, envVars, state.NetworkVolume.Id)
+		if err != nil {
+			return err
+		}
+		state.Pod = &PodState{Id: podId, Name: environmentResourceName(config, "dev"), CreatedAt: time.Now().UTC()}
+	} else if setDefaultNetworkVolume {
+		fmt.Println("The project pod already exists, --select-volume applies when a new pod is created")
+	}
+	if err := state.save(); err != nil {
+		return err
+	}
+
+	sshConn, err := PodSSHConnection(podId)
+	if err != nil {
+		return err
+	}
+
+	projectPathUuid := path.Join(config.Project.VolumeMountPath, config.Project.Uuid)
+	projectPathUuidDev := path.Join(projectPathUuid, "dev")
+	projectPathUuidProd := path.Join(projectPathUuid, "prod")
+	remoteProjectPath := path.Join(projectPathUuidDev, config.Name)
+	venvPath := path.Join(projectPathUuidDev, "venv")
+
+	fmt.Printf("Checking remote project folder: %s on Pod %s\n", remoteProjectPath, podId)
+	if err := sshConn.RunCommand(fmt.Sprintf("mkdir -p %s %s", remoteProjectPath, projectPathUuidProd)); err != nil {
+		return err
+	}
+
+	if len(config.Runtime.SystemPackages) > 0 {
+		fmt.Printf("Installing system packages on Pod %s\n", podId)
+		if err := sshConn.RunCommand(devSystemPackagesCommand(config.Runtime.SystemPackages)); err != nil {
+			return fmt.Errorf("installing system packages: %w", err)
+		}
+	}
+
+	fmt.Printf("Syncing files to Pod %s\n", podId)
+	if err := sshConn.Rsync(config.Dir()+"/", remoteProjectPath, false); err != nil {
+		return err
+	}
+
+	fmt.Printf("Activating Python virtual environment %s on Pod %s\n", venvPath, podId)
+	err = sshConn.RunCommands([]string{
+		fmt.Sprintf(`if ! [ -f %[1]s/bin/activate ]; then
+			echo "Creating Python virtual environment %[1]s"
+			python%[2]s -m virtualenv %[1]s
+		fi`, venvPath, config.Runtime.PythonVersion),
+		fmt.Sprintf(`source %s/bin/activate && cd %s && python -m pip install --upgrade pip && python -m pip install --requirement %s`,
+			venvPath, remoteProjectPath, config.Runtime.RequirementsPath),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, step := range config.Runtime.BuildSteps {
+		fmt.Printf("Running build step on Pod %s: %s\n", podId, step)
+		if err := sshConn.RunCommand(fmt.Sprintf("source %s/bin/activate && cd %s && %s", venvPath, remoteProjectPath, step)); err != nil {
+			return fmt.Errorf("build step %q: %w", step, err)
+		}
+	}
+
+	go sshConn.SyncDir(config.Dir()+"/", remoteProjectPath)
+
+	fmt.Printf("Starting handler %s on Pod %s\n", config.Runtime.HandlerPath, podId)
+	return sshConn.RunCommand(devServerScript(venvPath, remoteProjectPath, config.Runtime.HandlerPath))
+}
+
+// devServerScript runs the handler as a local API server on the pod and
+// restarts it whenever a synced file changes.
+func devServerScript(venvPath, remoteProjectPath, handlerPath string) string {
+	return fmt.Sprintf(`source %s/bin/activate
+cd %s
+touch /tmp/airfoil_last_reload
+while true; do
+	python -u %s --rp_serve_api --rp_api_host=0.0.0.0 --rp_api_port=7270 --rp_api_concurrency=1 &
+	server_pid=$!
+	while [ -z "$(find . -newer /tmp/airfoil_last_reload -type f -not -path './.git/*' -print -quit)" ]; do
+		sleep 1
+	done
+	touch /tmp/airfoil_last_reload
+	echo "Restarting handler..."
+	kill $server_pid 2>/dev/null
+	wait $server_pid 2>/dev/null
+done`, venvPath, remoteProjectPath, handlerPath)
+}
+
+// getProjectPod returns the id of the development pod of the environment,
+// looked up by the id in the state and then by name, or an empty string when
+// none exists. The state is updated with the pod found.
+func getProjectPod(config *ProjectConfig, state *ProjectState) (string, error) {
+	pods, err := api.GetPods()
+	if err != nil {
+		return "", fmt.Errorf("getting pods: %w", err)
+	}
+
+	if state.Pod != nil {
+		for _, pod := range pods {
+			if pod.Id == state.Pod.Id {
+				return pod.Id, nil
+			}
+		}
+	}
+	podName := environmentResourceName(config, "dev")
+	for _, pod := range pods {
+		if pod.Name == podName {
+			state.Pod = &PodState{Id: pod.Id, Name: pod.Name}
+			return pod.Id, nil
+		}
+	}
+
+	state.Pod = nil
+	return "", nil
+}
+
+func launchDevPod(config *ProjectConfig, envVars []EnvVar, networkVolumeId string) (string, error) {
+	fmt.Println("Deploying development pod on RunPod...")
+
+	if len(envVars) > 0 {
+		fmt.Println("Pod environment:")
+		for _, envVar := range envVars {
+			fmt.Printf("%s%s=%s\n", inputPromptPrefix, envVar.Key, envVar.Display())
+		}
+	}
+
+	gpuTypeIds, err := podGpuTypeIds(config)
+	if err != nil {
+		return "", err
+	}
+	for _, gpuType := range gpuTypeIds {
+		fmt.Printf("Trying to get a Pod with %s... ", gpuType)
+
+		input := &api.CreatePodInput{
+			CloudType:         "ALL",
+			ContainerDiskInGb: config.Project.ContainerDiskSizeGb,
+			Env:               toApiEnv(envVars),
+			GpuCount:          config.Project.GpuCount,
+			GpuTypeId:         gpuType,
+			ImageName:         config.Project.BaseImage,
+			Name:              environmentResourceName(config, "dev"),
+			NetworkVolumeId:   networkVolumeId,
+			Ports:             strings.ReplaceAll(config.Project.Ports, " ", ""),
+			SupportPublicIp:   true,
+			StartSSH:          true,
+			VolumeMountPath:   config.Project.VolumeMountPath,
+		}
+
+		pod, err := api.CreatePod(input)
+		if err != nil {
+			fmt.Println("Unavailable.")
+			continue
+		}
+
+		fmt.Println("Success!")
+		return pod["id"].(string), nil
+	}
+
+	return "", errors.New("none of the selected GPU types were available")
+}
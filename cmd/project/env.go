@@ -0,0 +1,180 @@
+package project
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yourusername/airfoil/api"
+)
+
+type envSource int
+
+const (
+	// envLiteral values are written as-is in runpod.toml.
+	envLiteral envSource = iota
+	// envLocal values were resolved from the local environment, a .env file or secrets.enc.
+	envLocal
+	// envSecret values reference a RunPod secret and are resolved by RunPod.
+	envSecret
+)
+
+var (
+	envReferencePattern    = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+	secretReferencePattern = regexp.MustCompile(`^\{\{\s*RUNPOD_SECRET_[A-Za-z0-9_.-]+\s*\}\}$`)
+)
+
+type EnvVar struct {
+	Key    string
+	Value  string
+	source envSource
+}
+
+// Display returns the value in a form that is safe to print.
+// Values that came from the local machine are masked.
+func (e EnvVar) Display() string {
+	if e.source == envLocal {
+		return "********"
+	}
+	return e.Value
+}
+
+// resolveProjectEnv builds the pod environment from runpod.toml.
+// Variables from project.env_file are added first, then the decrypted values
+// of secrets.enc, then project.env_vars with ${VAR} references expanded from
+// the local environment, the secrets file and the env file. References to
+// RunPod secrets are passed through untouched.
+func resolveProjectEnv(config *ProjectConfig) ([]EnvVar, error) {
+	dotenv := map[string]string{}
+	if config.Project.EnvFile != "" {
+		envFilePath := config.Project.EnvFile
+		if !filepath.IsAbs(envFilePath) {
+			envFilePath = filepath.Join(config.Dir(), envFilePath)
+		}
+
+		var err error
+		dotenv, err = readDotenv(envFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("reading env file: %w", err)
+		}
+	}
+
+	secrets, err := loadProjectSecrets(config.Dir())
+	if err != nil {
+		return nil, fmt.Errorf("loading project secrets: %w", err)
+	}
+
+	resolved := map[string]EnvVar{}
+	for key, value := range dotenv {
+		resolved[key] = EnvVar{Key: key, Value: value, source: envLocal}
+	}
+	for key, value := range secrets {
+		resolved[key] = EnvVar{Key: key, Value: value, source: envLocal}
+	}
+
+	lookup := func(name string) (string, bool) {
+		if value, ok := os.LookupEnv(name); ok {
+			return value, true
+		}
+		if value, ok := secrets[name]; ok {
+			return value, true
+		}
+		value, ok := dotenv[name]
+		return value, ok
+	}
+
+	for key, value := range config.Project.EnvVars {
+		envVar, err := resolveEnvValue(key, value, lookup)
+		if err != nil {
+			return nil, err
+		}
+		resolved[key] = envVar
+	}
+
+	keys := make([]string, 0, len(resolved))
+	for key := range resolved {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	envVars := make([]EnvVar, 0, len(keys))
+	for _, key := range keys {
+		envVars = append(envVars, resolved[key])
+	}
+	return envVars, nil
+}
+
+func resolveEnvValue(key, value string, lookup func(string) (string, bool)) (EnvVar, error) {
+	if secretReferencePattern.MatchString(strings.TrimSpace(value)) {
+		return EnvVar{Key: key, Value: strings.TrimSpace(value), source: envSecret}, nil
+	}
+
+	if !envReferencePattern.MatchString(value) {
+		return EnvVar{Key: key, Value: value, source: envLiteral}, nil
+	}
+
+	var missing []string
+	expanded := envReferencePattern.ReplaceAllStringFunc(value, func(reference string) string {
+		name := envReferencePattern.FindStringSubmatch(reference)[1]
+		resolved, ok := lookup(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return resolved
+	})
+	if len(missing) > 0 {
+		return EnvVar{}, fmt.Errorf("env var %s references undefined variable(s): %s", key, strings.Join(missing, ", "))
+	}
+
+	return EnvVar{Key: key, Value: expanded, source: envLocal}, nil
+}
+
+// readDotenv parses a .env file of KEY=VALUE lines.
+func readDotenv(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNumber)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func toApiEnv(envVars []EnvVar) []*api.PodEnv {
+	env := make([]*api.PodEnv, 0, len(envVars))
+	for _, envVar := range envVars {
+		env = append(env, &api.PodEnv{Key: envVar.Key, Value: envVar.Value})
+	}
+	return env
+}
@@ -0,0 +1,522 @@
+package project
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/yourusername/airfoil/api"
+	"github.com/yourusername/airfoil/format"
+)
+
+var (
+	estimateDtype     string
+	estimateBatchSize int
+	estimateSeqLen    int
+	estimateMaxGpus   int
+	estimateWrite     bool
+)
+
+var EstimateCmd = &cobra.Command{
+	Use:   "estimate [model]",
+	Short: "Estimate the VRAM a model needs and suggest GPU types",
+	Long: `Reads config.json and the safetensors headers of a local model to estimate the VRAM
+needed to serve it, and suggests a gpu_types list for runpod.toml.
+
+The model is a local directory, a Hugging Face cache folder or a model id such as
+google/flan-t5-base that was downloaded to the Hugging Face cache. Inside a project it
+defaults to the model the project was created with.
+
+When an API key is configured, current RunPod pricing is used to rank the GPU types.
+The estimate covers weights, KV cache, activations and CUDA overhead; it is a guide,
+not a guarantee.`,
+	Example: `  airfoil estimate ./models/llama-3-8b
+  airfoil estimate meta-llama/Meta-Llama-3-8B --dtype int8 --batch-size 4
+  airfoil estimate --write`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		model := ""
+		if len(args) > 0 {
+			model = args[0]
+		}
+		if err := estimateModel(model); err != nil {
+			fmt.Println("Failed to estimate VRAM:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	EstimateCmd.Flags().StringVar(&estimateDtype, "dtype", "auto", "Weight dtype to serve the model with: auto, float32, float16, bfloat16, int8 or int4")
+	EstimateCmd.Flags().IntVar(&estimateBatchSize, "batch-size", 1, "Number of sequences processed at once")
+	EstimateCmd.Flags().IntVar(&estimateSeqLen, "seq-len", 0, "Tokens per sequence (default is the model's context length, up to 4096)")
+	EstimateCmd.Flags().IntVar(&estimateMaxGpus, "max", 6, "Maximum number of GPU types to suggest")
+	EstimateCmd.Flags().BoolVar(&estimateWrite, "write", false, "Replace gpu_types in the runpod.toml of the current project with the suggestion")
+}
+
+// dtypeBytes is the size of one element of each dtype, for the names used by
+// safetensors, config.json and --dtype.
+var dtypeBytes = map[string]float64{
+	"F64": 8, "F32": 4, "F16": 2, "BF16": 2, "F8_E4M3": 1, "F8_E5M2": 1,
+	"I64": 8, "I32": 4, "I16": 2, "I8": 1, "U8": 1, "BOOL": 1,
+	"float32": 4, "float16": 2, "bfloat16": 2, "int8": 1, "int4": 0.5,
+}
+
+var servingDtypes = []string{"float32", "float16", "bfloat16", "int8", "int4"}
+
+var safetensorsDtypeNames = map[string]string{"F32": "float32", "F16": "float16", "BF16": "bfloat16", "I8": "int8", "U8": "int8"}
+
+const gib = 1 << 30
+
+// modelShape holds the parts of a model's config.json the estimate needs.
+type modelShape struct {
+	TorchDtype     string
+	Layers         int
+	HiddenSize     int
+	AttentionHeads int
+	KeyValueHeads  int
+	VocabSize      int
+	ContextLength  int
+	Parameters     int64
+	ParametersFrom string
+	StoredDtype    string
+}
+
+// vramEstimate is the memory needed to serve a model, in bytes.
+type vramEstimate struct {
+	Dtype       string
+	SeqLen      int
+	Weights     float64
+	KVCache     float64
+	Activations float64
+	Overhead    float64
+}
+
+func (e vramEstimate) Total() float64 {
+	return e.Weights + e.KVCache + e.Activations + e.Overhead
+}
+
+// gpuOption is a GPU type that fits the estimate.
+type gpuOption struct {
+	ID       string
+	MemoryGb int
+	Price    float64
+}
+
+func estimateModel(model string) error {
+	if model == "" {
+		if config, err := loadProjectConfig(); err == nil && config.Template != nil {
+			model = config.Template.ModelName
+		}
+		if model == "" {
+			return errors.New("no model given")
+		}
+	}
+
+	dir, err := resolveModelDir(model)
+	if err != nil {
+		return err
+	}
+	shape, err := readModelShape(dir)
+	if err != nil {
+		return err
+	}
+	estimate, err := estimateVram(shape, estimateDtype, estimateBatchSize, estimateSeqLen)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Model:        %s\n", dir)
+	fmt.Printf("Parameters:   %.2fB (%s)\n", float64(shape.Parameters)/1e9, shape.ParametersFrom)
+	fmt.Printf("Dtype:        %s\n", estimate.Dtype)
+	fmt.Printf("Weights:      %.1f GB\n", estimate.Weights/gib)
+	fmt.Printf("KV cache:     %.1f GB (batch %d x %d tokens)\n", estimate.KVCache/gib, estimateBatchSize, estimate.SeqLen)
+	fmt.Printf("Activations:  %.1f GB\n", estimate.Activations/gib)
+	fmt.Printf("Overhead:     %.1f GB\n", estimate.Overhead/gib)
+	fmt.Printf("Total:        %.1f GB\n\n", estimate.Total()/gib)
+
+	options, priced := suggestGpuTypes(estimate.Total()/gib, estimateMaxGpus)
+	if len(options) == 0 {
+		return fmt.Errorf("no single GPU type has %.1f GB of VRAM, try a smaller --dtype or --batch-size", estimate.Total()/gib)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"GPU Type", "VRAM", "Headroom", "Price/hr"})
+	format.TableDefaults(table)
+	gpuTypes := make([]string, 0, len(options))
+	for _, option := range options {
+		price := "-"
+		if option.Price > 0 {
+			price = fmt.Sprintf("$%.2f", option.Price)
+		}
+		headroom := float64(option.MemoryGb) - estimate.Total()/gib
+		table.Append([]string{option.ID, fmt.Sprintf("%dGB", option.MemoryGb), fmt.Sprintf("%.1fGB", headroom), price})
+		gpuTypes = append(gpuTypes, option.ID)
+	}
+	table.Render()
+	if !priced {
+		fmt.Println("Pricing unavailable, GPU types are ordered by VRAM.")
+	}
+
+	if !estimateWrite {
+		fmt.Printf("\ngpu_types = [\n%s]\n", formatGpuTypes(gpuTypes))
+		return nil
+	}
+
+	config, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	if err := writeGpuTypes(config.Dir(), gpuTypes); err != nil {
+		return err
+	}
+	fmt.Println("\nUpdated gpu_types in", projectConfigFile)
+	return nil
+}
+
+// resolveModelDir finds the directory holding config.json for a local path,
+// a Hugging Face cache folder or a model id in the Hugging Face cache.
+func resolveModelDir(model string) (string, error) {
+	if info, err := os.Stat(model); err == nil && info.IsDir() {
+		if _, err := os.Stat(filepath.Join(model, "config.json")); err == nil {
+			return model, nil
+		}
+		if snapshot, err := latestSnapshot(model); err == nil {
+			return snapshot, nil
+		}
+		return "", fmt.Errorf("no config.json found in %s", model)
+	}
+
+	if !strings.Contains(model, "/") {
+		return "", fmt.Errorf("%s is neither a directory nor a Hugging Face model id", model)
+	}
+	cacheDir := filepath.Join(huggingFaceCacheDir(), "models--"+strings.ReplaceAll(model, "/", "--"))
+	snapshot, err := latestSnapshot(cacheDir)
+	if err != nil {
+		return "", fmt.Errorf("%s is not in the Hugging Face cache at %s, download it first: %w", model, huggingFaceCacheDir(), err)
+	}
+	return snapshot, nil
+}
+
+func huggingFaceCacheDir() string {
+	if dir := os.Getenv("HF_HUB_CACHE"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("HF_HOME"); dir != "" {
+		return filepath.Join(dir, "hub")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".cache", "huggingface", "hub")
+}
+
+// latestSnapshot returns the snapshot of a Hugging Face cache folder that
+// refs/main points to, or the most recently modified one.
+func latestSnapshot(cacheDir string) (string, error) {
+	snapshots := filepath.Join(cacheDir, "snapshots")
+	if ref, err := os.ReadFile(filepath.Join(cacheDir, "refs", "main")); err == nil {
+		dir := filepath.Join(snapshots, strings.TrimSpace(string(ref)))
+		if _, err := os.Stat(filepath.Join(dir, "config.json")); err == nil {
+			return dir, nil
+		}
+	}
+
+	entries, err := os.ReadDir(snapshots)
+	if err != nil {
+		return "", err
+	}
+	latest, latestTime := "", int64(0)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(snapshots, entry.Name(), "config.json")); err != nil {
+			continue
+		}
+		if info.ModTime().Unix() > latestTime {
+			latest, latestTime = filepath.Join(snapshots, entry.Name()), info.ModTime().Unix()
+		}
+	}
+	if latest == "" {
+		return "", errors.New("no snapshot with a config.json")
+	}
+	return latest, nil
+}
+
+// readModelShape reads config.json and the safetensors headers in dir.
+func readModelShape(dir string) (*modelShape, error) {
+	content, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return nil, fmt.Errorf("reading config.json: %w", err)
+	}
+	config := map[string]any{}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("parsing config.json: %w", err)
+	}
+
+	shape := &modelShape{}
+	shape.TorchDtype, _ = config["torch_dtype"].(string)
+
+	// Multimodal models keep the language model dimensions in text_config.
+	if textConfig, ok := config["text_config"].(map[string]any); ok {
+		for key, value := range textConfig {
+			if key != "model_type" {
+				config[key] = value
+			}
+		}
+	}
+
+	shape.Layers = configInt(config, "num_hidden_layers", "n_layer", "num_layers", "num_decoder_layers")
+	shape.HiddenSize = configInt(config, "hidden_size", "n_embd", "d_model")
+	shape.AttentionHeads = configInt(config, "num_attention_heads", "n_head", "num_heads")
+	shape.KeyValueHeads = configInt(config, "num_key_value_heads", "num_kv_heads")
+	if shape.KeyValueHeads == 0 {
+		shape.KeyValueHeads = shape.AttentionHeads
+	}
+	shape.VocabSize = configInt(config, "vocab_size")
+	shape.ContextLength = configInt(config, "max_position_embeddings", "n_positions", "max_sequence_length", "seq_length")
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.safetensors"))
+	if err != nil {
+		return nil, err
+	}
+	dtypeCounts := map[string]int64{}
+	for _, file := range files {
+		tensors, err := readSafetensorsHeader(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", filepath.Base(file), err)
+		}
+		for _, tensor := range tensors {
+			elements := int64(1)
+			for _, dim := range tensor.Shape {
+				elements *= dim
+			}
+			shape.Parameters += elements
+			dtypeCounts[tensor.Dtype] += elements
+		}
+	}
+
+	if shape.Parameters > 0 {
+		shape.ParametersFrom = fmt.Sprintf("from %d safetensors file(s)", len(files))
+		var most int64
+		for dtype, count := range dtypeCounts {
+			if count > most {
+				shape.StoredDtype, most = dtype, count
+			}
+		}
+	} else {
+		if shape.Layers == 0 || shape.HiddenSize == 0 {
+			return nil, errors.New("no safetensors files and config.json has no layer dimensions to estimate from")
+		}
+		// Attention and MLP blocks have about 12*h^2 parameters per layer.
+		h := int64(shape.HiddenSize)
+		shape.Parameters = int64(shape.Layers)*12*h*h + int64(shape.VocabSize)*h
+		shape.ParametersFrom = "estimated from config.json"
+	}
+
+	return shape, nil
+}
+
+func configInt(config map[string]any, keys ...string) int {
+	for _, key := range keys {
+		if value, ok := config[key].(float64); ok && value > 0 {
+			return int(value)
+		}
+	}
+	return 0
+}
+
+type safetensorsTensor struct {
+	Dtype       string  `json:"dtype"`
+	Shape       []int64 `json:"shape"`
+	DataOffsets []int64 `json:"data_offsets"`
+}
+
+// readSafetensorsHeader reads the tensor index at the start of a safetensors
+// file without loading the weights.
+func readSafetensorsHeader(file string) (map[string]safetensorsTensor, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var size uint64
+	if err := binary.Read(f, binary.LittleEndian, &size); err != nil {
+		return nil, fmt.Errorf("reading header size: %w", err)
+	}
+	if size > 100<<20 {
+		return nil, fmt.Errorf("header of %d bytes is too large", size)
+	}
+
+	header := make([]byte, size)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(header, &raw); err != nil {
+		return nil, fmt.Errorf("parsing header: %w", err)
+	}
+	tensors := map[string]safetensorsTensor{}
+	for name, value := range raw {
+		if name == "__metadata__" {
+			continue
+		}
+		var tensor safetensorsTensor
+		if err := json.Unmarshal(value, &tensor); err != nil {
+			return nil, fmt.Errorf("parsing tensor %s: %w", name, err)
+		}
+		tensors[name] = tensor
+	}
+	return tensors, nil
+}
+
+// estimateVram estimates the memory needed to serve a model for inference.
+func estimateVram(shape *modelShape, dtype string, batchSize, seqLen int) (vramEstimate, error) {
+	if dtype == "auto" {
+		dtype = shape.TorchDtype
+		if name, ok := safetensorsDtypeNames[shape.StoredDtype]; ok && dtype == "" {
+			dtype = name
+		}
+		if dtype == "" {
+			dtype = "float16"
+		}
+	}
+	if !contains(dtype, servingDtypes) {
+		return vramEstimate{}, fmt.Errorf("unsupported dtype %q, use %s", dtype, strings.Join(servingDtypes, ", "))
+	}
+	weightBytes := dtypeBytes[dtype]
+	if batchSize < 1 {
+		return vramEstimate{}, errors.New("batch size must be at least 1")
+	}
+
+	if seqLen <= 0 {
+		seqLen = shape.ContextLength
+		if seqLen <= 0 {
+			seqLen = 2048
+		}
+		seqLen = min(seqLen, 4096)
+	}
+
+	// Quantized models still compute and cache in half precision.
+	computeBytes := max(weightBytes, 2)
+
+	estimate := vramEstimate{Dtype: dtype, SeqLen: seqLen}
+	estimate.Weights = float64(shape.Parameters) * weightBytes
+
+	tokens := float64(batchSize) * float64(seqLen)
+	if shape.AttentionHeads > 0 {
+		headDim := float64(shape.HiddenSize) / float64(shape.AttentionHeads)
+		estimate.KVCache = 2 * float64(shape.Layers) * tokens * float64(shape.KeyValueHeads) * headDim * computeBytes
+		// A few hidden-sized buffers per token, plus the attention scores of one layer.
+		estimate.Activations = tokens*float64(shape.HiddenSize)*computeBytes*4 +
+			float64(batchSize)*float64(shape.AttentionHeads)*float64(seqLen)*float64(seqLen)*computeBytes
+	}
+
+	// CUDA context, kernels and allocator fragmentation.
+	estimate.Overhead = 1*gib + estimate.Weights*0.05
+
+	return estimate, nil
+}
+
+// suggestGpuTypes returns up to limit GPU types with at least requiredGb of
+// VRAM, cheapest first when pricing is available, otherwise smallest first.
+func suggestGpuTypes(requiredGb float64, limit int) ([]gpuOption, bool) {
+	options := map[string]*gpuOption{}
+	for id, memory := range gpuMemoryGb {
+		options[id] = &gpuOption{ID: id, MemoryGb: memory}
+	}
+
+	priced := false
+	if apiKeyConfigured() {
+		gpuTypes, err := api.GetCloud(&api.GetCloudInput{GpuCount: 1})
+		if err == nil {
+			for _, raw := range gpuTypes {
+				gpuType, ok := raw.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				id, _ := gpuType["id"].(string)
+				if id == "" {
+					continue
+				}
+				option, ok := options[id]
+				if !ok {
+					option = &gpuOption{ID: id}
+					options[id] = option
+				}
+				if memory, ok := gpuType["memoryInGb"].(float64); ok && memory > 0 {
+					option.MemoryGb = int(memory)
+				}
+				if lowestPrice, ok := gpuType["lowestPrice"].(map[string]interface{}); ok {
+					if price, ok := lowestPrice["uninterruptablePrice"].(float64); ok && price > 0 {
+						option.Price = price
+						priced = true
+					}
+				}
+			}
+		}
+	}
+
+	fitting := []gpuOption{}
+	for _, option := range options {
+		if option.MemoryGb > 0 && float64(option.MemoryGb) >= requiredGb {
+			fitting = append(fitting, *option)
+		}
+	}
+
+	sort.Slice(fitting, func(i, j int) bool {
+		a, b := fitting[i], fitting[j]
+		if priced && (a.Price > 0) != (b.Price > 0) {
+			return a.Price > 0
+		}
+		if priced && a.Price != b.Price {
+			return a.Price < b.Price
+		}
+		if a.MemoryGb != b.MemoryGb {
+			return a.MemoryGb < b.MemoryGb
+		}
+		return a.ID < b.ID
+	})
+
+	if limit > 0 && len(fitting) > limit {
+		fitting = fitting[:limit]
+	}
+	return fitting, priced
+}
+
+func apiKeyConfigured() bool {
+	return os.Getenv("RUNPOD_API_KEY") != "" || viper.GetString("apiKey") != ""
+}
+
+var gpuTypesPattern = regexp.MustCompile(`(?ms)^gpu_types\s*=\s*\[.*?\]`)
+
+// writeGpuTypes replaces the gpu_types array of the runpod.toml in projectDir.
+func writeGpuTypes(projectDir string, gpuTypes []string) error {
+	tomlPath := filepath.Join(projectDir, projectConfigFile)
+	content, err := os.ReadFile(tomlPath)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", projectConfigFile, err)
+	}
+	if !gpuTypesPattern.Match(content) {
+		return fmt.Errorf("%s has no gpu_types array", projectConfigFile)
+	}
+
+	replacement := "gpu_types = [\n" + formatGpuTypes(gpuTypes) + "]"
+	content = gpuTypesPattern.ReplaceAllLiteral(content, []byte(replacement))
+	if err := os.WriteFile(tomlPath, content, 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", projectConfigFile, err)
+	}
+	return nil
+}
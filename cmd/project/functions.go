@@ -6,6 +6,8 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/textinput"
@@ -20,54 +22,151 @@ const basePath string = "starter_templates"
 
 var (
 	focusedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#673ab7"))
-	blurredStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#673ab7"))
-	// cursorStyle  = focusedStyle.Copy()
-	noStyle = lipgloss.NewStyle()
-
-	blurredButton = lipgloss.NewStyle().Foreground(lipgloss.Color("#673ab7")).Render("[ Submit ]")
-	focusedButton = lipgloss.NewStyle().Foreground(lipgloss.Color("#673ab7")).Render("[ Submit ]")
+	blurredStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#9e9e9e"))
+	errorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#e53935"))
+	noStyle      = lipgloss.NewStyle()
 )
 
+var projectNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+type wizardChoice struct {
+	Label string
+	Value string
+}
+
+// wizardStep is one question of the create wizard. Steps with choices are
+// select lists, the others are free text inputs.
+type wizardStep struct {
+	key      string
+	title    string
+	choices  []wizardChoice
+	cursor   int
+	input    textinput.Model
+	validate func(string) error
+	value    string
+}
+
+// createAnswers holds everything create needs, whether it came from flags or
+// from the wizard.
+type createAnswers struct {
+	ProjectName   string            `yaml:"name"`
+	TemplateRef   string            `yaml:"template"`
+	ModelName     string            `yaml:"model"`
+	CudaVersion   string            `yaml:"cuda"`
+	PythonVersion string            `yaml:"python"`
+	Variables     map[string]string `yaml:"vars"`
+}
+
 type model struct {
-	inputs     []textinput.Model
-	focusIndex int
-	err        error
+	defaults  createAnswers
+	steps     []*wizardStep
+	current   int
+	template  *TemplateManifest
+	err       error
+	confirmed bool
+}
+
+func newTextStep(key, title, value, placeholder string, validate func(string) error) *wizardStep {
+	t := textinput.New()
+	t.Prompt = inputPromptPrefix
+	t.Placeholder = placeholder
+	t.SetValue(value)
+	t.PromptStyle = focusedStyle
+	t.TextStyle = focusedStyle
+	return &wizardStep{key: key, title: title, input: t, validate: validate}
+}
+
+func newSelectStep(key, title string, choices []wizardChoice, selected string) *wizardStep {
+	step := &wizardStep{key: key, title: title, choices: choices}
+	for i, choice := range choices {
+		if choice.Value == selected {
+			step.cursor = i
+		}
+	}
+	return step
 }
 
-func initialModel() model {
-	var inputs []textinput.Model
-	inputs = make([]textinput.Model, 5)
-
-	var t textinput.Model
-	for i := range inputs {
-		t = textinput.New()
-		// t.CursorStyle = cursorStyle
-		// t.CharLimit = 32
-
-		switch i {
-		case 0:
-			t.Placeholder = "Project Name"
-			t.Focus()
-			t.PromptStyle = focusedStyle
-			t.TextStyle = focusedStyle
-		case 1:
-			t.Placeholder = "Use case: Text | Embed | Image | Audio"
-			t.CharLimit = 64
-		case 2:
-			t.Placeholder = "Hugging Face Model Name: openchat/openchat-3.5-0106"
-		case 3:
-			t.Placeholder = "CUDA Version: 12.5, 12.4, 12.3, 12.2, etc."
-		case 4:
-			t.Placeholder = "Python Version: 3.11, 3.10, 3.9, 3.8"
+func validateProjectName(name string) error {
+	if !projectNamePattern.MatchString(name) {
+		return fmt.Errorf("use letters, digits, '.', '_' and '-' only")
+	}
+	if _, err := os.Stat(name); err == nil {
+		return fmt.Errorf("%s already exists in the current directory", name)
+	}
+	return nil
+}
+
+func templateChoices() []wizardChoice {
+	choices := []wizardChoice{}
+	if manifests, err := listStarterTemplates(); err == nil {
+		for _, manifest := range manifests {
+			label := strings.ReplaceAll(manifest.Name, "_", " ")
+			if manifest.Description != "" {
+				label += " - " + manifest.Description
+			}
+			choices = append(choices, wizardChoice{Label: label, Value: manifest.Name})
 		}
+	}
+
+	configured := configuredTemplateSources()
+	names := make([]string, 0, len(configured))
+	for name := range configured {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		choices = append(choices, wizardChoice{Label: name + " - " + configured[name], Value: name})
+	}
+	return choices
+}
 
-		inputs[i] = t
+func versionChoices(versions []string) []wizardChoice {
+	choices := make([]wizardChoice, 0, len(versions))
+	for _, version := range versions {
+		choices = append(choices, wizardChoice{Label: version, Value: version})
 	}
+	return choices
+}
 
-	return model{
-		inputs:     inputs,
-		focusIndex: 0,
+// initialModel prepares the create wizard, preselecting any values that were
+// given as flags.
+func initialModel(defaults createAnswers) model {
+	steps := []*wizardStep{
+		newTextStep("name", "Project name", defaults.ProjectName, "my-project", validateProjectName),
+		newSelectStep("template", "Starter template", templateChoices(), defaults.TemplateRef),
 	}
+	steps[0].input.Focus()
+
+	return model{defaults: defaults, steps: steps}
+}
+
+// addTemplateSteps replaces the steps after the template choice with the
+// questions for the chosen template.
+func (m *model) addTemplateSteps(manifest *TemplateManifest) {
+	defaults := m.defaults
+	m.template = manifest
+
+	steps := m.steps[:m.current+1]
+	steps = append(steps, newTextStep("model", "Hugging Face model name", defaults.ModelName, manifest.DefaultModel, nil))
+	for _, variable := range manifest.Variables {
+		title := variable.Name
+		if variable.Prompt != "" {
+			title = variable.Prompt + " (" + variable.Name + ")"
+		}
+		steps = append(steps, newTextStep("var:"+variable.Name, title, defaults.Variables[variable.Name], variable.Default, func(value string) error {
+			if value == "" {
+				value = variable.Default
+			}
+			return variable.Validate(value)
+		}))
+	}
+	cudaStep := newSelectStep("cuda", "CUDA version", versionChoices(supportedCudaVersions()), defaults.CudaVersion)
+	pythonStep := newSelectStep("python", "Python version", versionChoices(supportedPythonVersions()), defaults.PythonVersion)
+	pythonStep.validate = func(value string) error {
+		return validateRuntime(cudaStep.value, value)
+	}
+	steps = append(steps, cudaStep, pythonStep)
+	m.steps = steps
 }
 
 func (m model) Init() tea.Cmd {
@@ -75,123 +174,241 @@ func (m model) Init() tea.Cmd {
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	switch msg := msg.(type) {
-	case tea.KeyMsg:
-		switch msg.String() {
-		case "ctrl+c", "esc":
-			return m, tea.Quit
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, m.updateInput(msg)
+	}
 
-		case "tab", "shift+tab", "enter", "up", "down":
-			s := msg.String()
+	switch keyMsg.String() {
+	case "ctrl+c", "esc":
+		return m, tea.Quit
 
-			if s == "enter" && m.focusIndex == len(m.inputs)-1 {
-				return m, tea.Quit
-			}
+	case "shift+tab":
+		m.err = nil
+		if m.current > 0 {
+			m.current--
+		}
+		return m, m.focusCurrent()
+	}
 
-			if s == "up" || s == "shift+tab" {
-				m.focusIndex--
-			} else {
-				m.focusIndex++
-			}
+	// Summary screen
+	if m.current == len(m.steps) {
+		if keyMsg.String() == "enter" {
+			m.confirmed = true
+			return m, tea.Quit
+		}
+		return m, nil
+	}
 
-			if m.focusIndex > len(m.inputs)-1 {
-				m.focusIndex = 0
-			} else if m.focusIndex < 0 {
-				m.focusIndex = len(m.inputs) - 1
+	step := m.steps[m.current]
+	if step.choices != nil {
+		switch keyMsg.String() {
+		case "up", "k":
+			if step.cursor > 0 {
+				step.cursor--
 			}
-
-			cmds := make([]tea.Cmd, len(m.inputs))
-			for i := 0; i <= len(m.inputs)-1; i++ {
-				if i == m.focusIndex {
-					cmds[i] = m.inputs[i].Focus()
-					m.inputs[i].PromptStyle = focusedStyle
-					m.inputs[i].TextStyle = focusedStyle
-					continue
-				}
-				m.inputs[i].Blur()
-				m.inputs[i].PromptStyle = noStyle
-				m.inputs[i].TextStyle = noStyle
+			return m, nil
+		case "down", "j":
+			if step.cursor < len(step.choices)-1 {
+				step.cursor++
 			}
+			return m, nil
+		}
+	}
 
-			return m, tea.Batch(cmds...)
+	if keyMsg.String() != "enter" {
+		return m, m.updateInput(msg)
+	}
+
+	value := strings.TrimSpace(step.input.Value())
+	if step.choices != nil {
+		if len(step.choices) == 0 {
+			m.err = fmt.Errorf("no options available")
+			return m, nil
+		}
+		value = step.choices[step.cursor].Value
+	}
+	if step.validate != nil {
+		if err := step.validate(value); err != nil {
+			m.err = err
+			return m, nil
 		}
 	}
+	step.value = value
+	m.err = nil
 
-	cmd := m.updateInputs(msg)
+	if step.key == "template" && (m.template == nil || m.template.Name != value) {
+		manifest, err := findTemplate(value)
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.addTemplateSteps(manifest)
+	}
 
-	return m, cmd
+	m.current++
+	return m, m.focusCurrent()
 }
 
-func (m *model) updateInputs(msg tea.Msg) tea.Cmd {
-	cmds := make([]tea.Cmd, len(m.inputs))
+func (m *model) focusCurrent() tea.Cmd {
+	for i, step := range m.steps {
+		if step.choices != nil {
+			continue
+		}
+		if i == m.current {
+			step.input.Focus()
+		} else {
+			step.input.Blur()
+		}
+	}
+	return textinput.Blink
+}
 
-	for i := range m.inputs {
-		m.inputs[i], cmds[i] = m.inputs[i].Update(msg)
+func (m *model) updateInput(msg tea.Msg) tea.Cmd {
+	if m.current >= len(m.steps) || m.steps[m.current].choices != nil {
+		return nil
 	}
 
-	return tea.Batch(cmds...)
+	var cmd tea.Cmd
+	step := m.steps[m.current]
+	step.input, cmd = step.input.Update(msg)
+	return cmd
 }
 
 func (m model) View() string {
 	var b strings.Builder
+	b.WriteString(focusedStyle.Render("Create a new RunPod project") + "\n\n")
+
+	for i, step := range m.steps[:min(m.current, len(m.steps))] {
+		fmt.Fprintf(&b, "%s %s: %s\n", focusedStyle.Render("✔"), step.title, m.displayValue(i))
+	}
+
+	if m.current == len(m.steps) {
+		b.WriteString("\n" + focusedStyle.Render("Create the project with these settings?") + "\n")
+		b.WriteString(blurredStyle.Render("enter: create • shift+tab: back • esc: cancel") + "\n")
+		return b.String()
+	}
 
-	for i := range m.inputs {
-		b.WriteString(m.inputs[i].View())
-		if i < len(m.inputs)-1 {
-			b.WriteRune('\n')
+	step := m.steps[m.current]
+	fmt.Fprintf(&b, "\n%s\n", step.title)
+	if step.choices != nil {
+		for i, choice := range step.choices {
+			if i == step.cursor {
+				fmt.Fprintf(&b, "%s\n", focusedStyle.Render(" ● "+choice.Label))
+			} else {
+				fmt.Fprintf(&b, "%s\n", noStyle.Render("   "+choice.Label))
+			}
 		}
+	} else {
+		b.WriteString(step.input.View() + "\n")
 	}
 
-	button := &blurredButton
-	if m.focusIndex == len(m.inputs) {
-		button = &focusedButton
+	if m.err != nil {
+		b.WriteString(errorStyle.Render("   "+m.err.Error()) + "\n")
 	}
-	fmt.Fprintf(&b, "\n\n%s\n", *button)
 
+	help := "enter: next • shift+tab: back • esc: cancel"
+	if step.choices != nil {
+		help = "↑/↓: choose • " + help
+	}
+	b.WriteString("\n" + blurredStyle.Render(help) + "\n")
 	return b.String()
 }
 
-func main() {
-	p := tea.NewProgram(initialModel())
-	m, err := p.Run()
+// displayValue returns the answer of step i as shown in the summary.
+func (m model) displayValue(i int) string {
+	step := m.steps[i]
+	if step.value == "" && step.input.Placeholder != "" {
+		return step.input.Placeholder + " (default)"
+	}
+	return step.value
+}
+
+func (m model) answers() createAnswers {
+	answers := createAnswers{Variables: map[string]string{}}
+	for _, step := range m.steps {
+		switch {
+		case step.key == "name":
+			answers.ProjectName = step.value
+		case step.key == "template":
+			answers.TemplateRef = step.value
+		case step.key == "model":
+			answers.ModelName = step.value
+		case step.key == "cuda":
+			answers.CudaVersion = step.value
+		case step.key == "python":
+			answers.PythonVersion = step.value
+		case strings.HasPrefix(step.key, "var:") && step.value != "":
+			answers.Variables[strings.TrimPrefix(step.key, "var:")] = step.value
+		}
+	}
+	return answers
+}
+
+// runCreateWizard asks for the project settings interactively. It returns
+// nil answers when the user cancels.
+func runCreateWizard(defaults createAnswers) (*createAnswers, error) {
+	result, err := tea.NewProgram(initialModel(defaults)).Run()
 	if err != nil {
-		fmt.Printf("Alas, there's been an error: %v", err)
-		os.Exit(1)
+		return nil, err
 	}
 
-	if m, ok := m.(model); ok {
-		createNewProject(
-			m.inputs[0].Value(),
-			m.inputs[1].Value(),
-			m.inputs[2].Value(),
-			m.inputs[3].Value(),
-			m.inputs[4].Value(),
-		)
+	m, ok := result.(model)
+	if !ok || !m.confirmed {
+		return nil, nil
 	}
+	answers := m.answers()
+	return &answers, nil
 }
 
-func createNewProject(projectName, modelType, modelName, cudaVersion, pythonVersion string) {
+func createNewProject(projectName, templateRef, modelName, cudaVersion, pythonVersion string, variables map[string]string) error {
 	currentDir, err := os.Getwd()
 	if err != nil {
-		fmt.Println("Error getting current directory:", err)
-		return
+		return fmt.Errorf("getting current directory: %w", err)
 	}
 
-	projectDir := filepath.Join(currentDir, projectName)
-	err = os.Mkdir(projectDir, 0755)
+	// --name and --answers skip the wizard and its validation.
+	if err := validateProjectName(projectName); err != nil {
+		return fmt.Errorf("invalid project name %q: %w", projectName, err)
+	}
+
+	if err := validateRuntime(cudaVersion, pythonVersion); err != nil {
+		return err
+	}
+
+	starterTemplate, err := findTemplate(templateRef)
+	if err != nil {
+		return err
+	}
+	resolvedVariables, err := starterTemplate.resolveVariables(variables)
 	if err != nil {
-		fmt.Println("Error creating project directory:", err)
-		return
+		return err
+	}
+
+	projectDir := filepath.Join(currentDir, projectName)
+	if err := os.Mkdir(projectDir, 0755); err != nil {
+		return fmt.Errorf("creating project directory: %w", err)
 	}
 
 	fmt.Println("Creating project in directory:", projectDir)
 
-	createProjectStructure(projectDir, modelType, modelName, cudaVersion, pythonVersion)
+	if err := createProjectStructure(projectDir, projectName, starterTemplate, modelName, cudaVersion, pythonVersion, resolvedVariables); err != nil {
+		// Leave no half-rendered project behind, so create can be run again.
+		if removeErr := os.RemoveAll(projectDir); removeErr != nil {
+			fmt.Printf("Could not remove %s: %s\n", projectDir, removeErr)
+		}
+		return err
+	}
 
 	fmt.Println("Project created successfully in:", projectDir)
+	return nil
 }
 
-func copyFiles(files fs.FS, source string, dest string) error {
+// copyFiles copies the tree at source in files to dest, passing the content
+// of every regular file through render. Files keep their permissions, made
+// writable by the owner as embedded files are read-only. Template manifests,
+// cache metadata and .git directories are not copied.
+func copyFiles(files fs.FS, source string, dest string, render func(path string, content []byte) ([]byte, error)) error {
 	return fs.WalkDir(files, source, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -204,6 +421,12 @@ func copyFiles(files fs.FS, source string, dest string) error {
 		if err != nil {
 			return err
 		}
+		if relPath == templateManifestFile || relPath == templateSourceFile {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return fs.SkipDir
+		}
 
 		newPath := filepath.Join(dest, relPath)
 		if d.IsDir() {
@@ -211,11 +434,23 @@ func copyFiles(files fs.FS, source string, dest string) error {
 				return err
 			}
 		} else {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
 			content, err := fs.ReadFile(files, path)
 			if err != nil {
 				return err
 			}
-			if err := os.WriteFile(newPath, content, 0o644); err != nil {
+			content, err = render(relPath, content)
+			if err != nil {
+				return err
+			}
+			mode := info.Mode().Perm() | 0o600
+			if err := os.WriteFile(newPath, content, mode); err != nil {
+				return err
+			}
+			if err := os.Chmod(newPath, mode); err != nil {
 				return err
 			}
 		}
@@ -223,70 +458,72 @@ func copyFiles(files fs.FS, source string, dest string) error {
 	})
 }
 
-func createProjectStructure(projectDir, modelType, modelName, cudaVersion, pythonVersion string) {
-	// Create README file
-	readmePath := filepath.Join(projectDir, "README.md")
-	readmeContent := fmt.Sprintf(`# %s
-
-Model Type: %s
-Model Name: %s
-CUDA Version: %s
-Python Version: %s
-`, projectName, modelType, modelName, cudaVersion, pythonVersion)
-	err := os.WriteFile(readmePath, []byte(readmeContent), 0644)
-	if err != nil {
-		fmt.Println("Error writing README file:", err)
+// createProjectStructure renders starterTemplate into projectDir, keeps a
+// pristine copy for later upgrades and writes the project's runpod.toml.
+func createProjectStructure(projectDir, projectName string, starterTemplate *TemplateManifest, modelName, cudaVersion, pythonVersion string, variables map[string]string) error {
+	if modelName == "" {
+		modelName = starterTemplate.DefaultModel
 	}
 
-	// Create src directory
-	srcDir := filepath.Join(projectDir, "src")
-	err = os.Mkdir(srcDir, 0755)
-	if err != nil {
-		fmt.Println("Error creating src directory:", err)
+	record := &TemplateRecord{
+		Name:          starterTemplate.Name,
+		Source:        starterTemplate.Source,
+		Version:       starterTemplate.Version,
+		ModelName:     modelName,
+		CudaVersion:   cudaVersion,
+		PythonVersion: pythonVersion,
+		Vars:          variables,
 	}
 
-	// Create a simple main.py file in src directory
-	mainPyPath := filepath.Join(srcDir, "main.py")
-	mainPyContent := fmt.Sprintf(`# main.py
+	if err := renderStarterTemplate(starterTemplate, projectDir, projectName, record); err != nil {
+		return err
+	}
+	if err := renderStarterTemplate(starterTemplate, filepath.Join(projectDir, templateSnapshotDir), projectName, record); err != nil {
+		return err
+	}
 
-print("Hello from %s!")
-`, projectName)
-	err = os.WriteFile(mainPyPath, []byte(mainPyContent), 0644)
+	baseImage, err := baseImageFor(cudaVersion)
 	if err != nil {
-		fmt.Println("Error writing main.py file:", err)
+		return err
 	}
 
-	// Create Dockerfile
-	dockerfilePath := filepath.Join(projectDir, "Dockerfile")
-	dockerfileContent := fmt.Sprintf(`FROM nvidia/cuda:%s-cudnn8-devel-ubuntu20.04
-
-RUN apt-get update && apt-get install -y \
-    python%s \
-    python3-pip \
-    && rm -rf /var/lib/apt/lists/*
+	return generateProjectToml(projectDir, projectConfigFile, projectTomlValues{
+		Name:             projectName,
+		BaseImage:        baseImage,
+		GpuTypes:         starterTemplate.GpuTypes,
+		PythonVersion:    pythonVersion,
+		HandlerPath:      "src/handler.py",
+		RequirementsPath: "builder/requirements.txt",
+		Template:         record,
+	})
+}
 
-COPY src/ /app/
-WORKDIR /app
+// renderStarterTemplate copies starterTemplate into dir with the values in
+// record and runs its post-create actions.
+func renderStarterTemplate(starterTemplate *TemplateManifest, dir, projectName string, record *TemplateRecord) error {
+	vars := templateVars{
+		ProjectName:   projectName,
+		ModelType:     starterTemplate.Name,
+		ModelName:     record.ModelName,
+		CudaVersion:   record.CudaVersion,
+		PythonVersion: record.PythonVersion,
+		Runpod:        "runpod",
+		Vars:          record.Vars,
+	}
 
-RUN pip install --no-cache-dir -r requirements.txt
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
 
-CMD ["python3", "main.py"]
-`, cudaVersion, pythonVersion)
-	err = os.WriteFile(dockerfilePath, []byte(dockerfileContent), 0644)
+	err := copyFiles(starterTemplate.files, ".", dir, func(name string, content []byte) ([]byte, error) {
+		return renderTemplate(content, vars), nil
+	})
 	if err != nil {
-		fmt.Println("Error writing Dockerfile:", err)
+		return fmt.Errorf("copying starter template %s: %w", starterTemplate.Name, err)
 	}
 
-	// Create requirements.txt
-	requirementsPath := filepath.Join(projectDir, "requirements.txt")
-	requirementsContent := fmt.Sprintf(`# requirements.txt
-
-# Add your project dependencies here
-# e.g., transformers==4.10.3
-`)
-
-	err = os.WriteFile(requirementsPath, []byte(requirementsContent), 0644)
-	if err != nil {
-		fmt.Println("Error writing requirements.txt file:", err)
+	if err := starterTemplate.applyPostCreateActions(dir, vars); err != nil {
+		return fmt.Errorf("running post-create actions of %s: %w", starterTemplate.Name, err)
 	}
+	return nil
 }
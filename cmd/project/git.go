@@ -0,0 +1,167 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// releaseEnvironments are the environments whose deploys --tag-release tags.
+var releaseEnvironments = []string{"production", "prod"}
+
+var (
+	allowDirty bool
+	tagRelease bool
+)
+
+// gitRevision is the git checkout an image was built from. It is empty
+// outside a git repository.
+type gitRevision struct {
+	Commit string `json:"commit,omitempty"`
+	Branch string `json:"branch,omitempty"`
+	// Dirty is set when the project folder had uncommitted changes.
+	Dirty bool `json:"dirty,omitempty"`
+}
+
+// ShortCommit returns the abbreviated commit, marked when the tree was dirty.
+func (r gitRevision) ShortCommit() string {
+	if r.Commit == "" {
+		return ""
+	}
+	short := r.Commit[:min(len(r.Commit), 7)]
+	if r.Dirty {
+		short += "-dirty"
+	}
+	return short
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("running git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("running git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// currentGitRevision describes the checkout of the project in dir. Changes
+// to the files airfoil keeps in .runpod do not make the tree dirty.
+func currentGitRevision(dir string) gitRevision {
+	commit, err := runGit(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return gitRevision{}
+	}
+	revision := gitRevision{Commit: commit}
+	if branch, err := runGit(dir, "rev-parse", "--abbrev-ref", "HEAD"); err == nil && branch != "HEAD" {
+		revision.Branch = branch
+	}
+	status, err := runGit(dir, "status", "--porcelain", "--", ".", ":(exclude).runpod")
+	revision.Dirty = err != nil || status != ""
+	return revision
+}
+
+// gitCommitURL returns a web link to commit on the origin remote of the
+// repository in dir, or an empty string when the remote is unknown.
+func gitCommitURL(dir, commit string) string {
+	remote, err := runGit(dir, "remote", "get-url", "origin")
+	if err != nil || commit == "" {
+		return ""
+	}
+
+	// git@host:owner/repo.git, ssh://git@host:22/owner/repo.git and
+	// https://user@host/owner/repo.git all become https://host/owner/repo.
+	base := strings.TrimSuffix(strings.TrimSuffix(remote, "/"), ".git")
+	switch {
+	case strings.HasPrefix(base, "https://"), strings.HasPrefix(base, "http://"), strings.HasPrefix(base, "ssh://"):
+		_, rest, _ := strings.Cut(base, "://")
+		if _, hostPath, ok := strings.Cut(rest, "@"); ok {
+			rest = hostPath
+		}
+		host, path, ok := strings.Cut(rest, "/")
+		if !ok {
+			return ""
+		}
+		host, _, _ = strings.Cut(host, ":")
+		base = "https://" + host + "/" + path
+	case strings.Contains(base, ":"):
+		userHost, path, _ := strings.Cut(base, ":")
+		if _, host, ok := strings.Cut(userHost, "@"); ok {
+			userHost = host
+		}
+		base = "https://" + userHost + "/" + path
+	default:
+		return ""
+	}
+
+	if strings.HasPrefix(base, "https://bitbucket.org/") {
+		return base + "/commits/" + commit
+	}
+	return base + "/commit/" + commit
+}
+
+func isReleaseEnvironment(environment string) bool {
+	for _, name := range releaseEnvironments {
+		if environment == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGitRevision refuses to deploy an image built from uncommitted changes
+// unless --allow-dirty is given, and to tag a release of it in any case.
+func checkGitRevision(revision gitRevision, environment string) error {
+	if tagRelease && isReleaseEnvironment(environment) {
+		if revision.Commit == "" {
+			return errors.New("--tag-release needs an image built by airfoil from a git checkout")
+		}
+		if revision.Dirty {
+			return errors.New("the image was built from uncommitted changes, commit them and rebuild before tagging a release")
+		}
+	}
+	if !revision.Dirty {
+		return nil
+	}
+	if !allowDirty {
+		return fmt.Errorf("the image was built from uncommitted changes, commit them and rebuild, or pass --allow-dirty")
+	}
+	fmt.Println("Deploying an image built from uncommitted changes, the deploy records the last commit only")
+	return nil
+}
+
+// tagDeployRelease creates an annotated git tag on the commit of the last
+// deploy of a release environment, when --tag-release is given. The tag is
+// recorded in the deploy history.
+func tagDeployRelease(state *ProjectState) error {
+	if !tagRelease || len(state.History) == 0 {
+		return nil
+	}
+	if !isReleaseEnvironment(state.environment) {
+		fmt.Printf("Not tagging a release, %s is not one of the release environments (%s)\n", state.environment, strings.Join(releaseEnvironments, ", "))
+		return nil
+	}
+	record := &state.History[len(state.History)-1]
+	if record.Commit == "" || record.Dirty {
+		fmt.Println("Not tagging a release, the deploy was not made from a clean git checkout")
+		return nil
+	}
+
+	tag := fmt.Sprintf("deploy/%s/%s", state.environment, record.DeployedAt.Format("20060102-150405"))
+	message := fmt.Sprintf("Deploy of %s to endpoint %s\n\nTemplate: %s (%s)\nDeployed by: %s at %s",
+		record.Image, record.EndpointId, record.TemplateName, record.TemplateId, record.User, record.DeployedAt.Format(time.RFC3339))
+	if _, err := runGit(state.dir, "tag", "--annotate", tag, "--message", message, record.Commit); err != nil {
+		return fmt.Errorf("deployed, but tagging the release failed: %w", err)
+	}
+	record.Tag = tag
+	if err := state.save(); err != nil {
+		return err
+	}
+	fmt.Printf("Tagged %s as %s, push it with: git push origin %s\n", record.ShortCommit(), tag, tag)
+	return nil
+}
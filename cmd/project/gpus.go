@@ -0,0 +1,354 @@
+package project
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yourusername/airfoil/api"
+)
+
+// gpuCatalogMaxAge is how long the GPU types fetched from RunPod are used
+// before they are fetched again.
+const gpuCatalogMaxAge = 24 * time.Hour
+
+// gpuPools maps GPU type ids to the serverless pool that contains them.
+// Endpoints are given pools, not GPU types, so a type without a pool cannot
+// run serverless workers.
+var gpuPools = map[string]string{
+	"NVIDIA RTX A4000":                   "AMPERE_16",
+	"NVIDIA RTX A4500":                   "AMPERE_16",
+	"NVIDIA RTX 4000 Ada Generation":     "AMPERE_16",
+	"NVIDIA RTX 4000 SFF Ada Generation": "AMPERE_16",
+	"NVIDIA RTX 2000 Ada Generation":     "AMPERE_16",
+	"NVIDIA L4":                          "AMPERE_24",
+	"NVIDIA RTX A5000":                   "AMPERE_24",
+	"NVIDIA GeForce RTX 3090":            "AMPERE_24",
+	"NVIDIA GeForce RTX 4090":            "ADA_24",
+	"NVIDIA RTX A6000":                   "AMPERE_48",
+	"NVIDIA A40":                         "AMPERE_48",
+	"NVIDIA L40":                         "ADA_48_PRO",
+	"NVIDIA L40S":                        "ADA_48_PRO",
+	"NVIDIA RTX 6000 Ada Generation":     "ADA_48_PRO",
+	"NVIDIA A100 80GB PCIe":              "AMPERE_80",
+	"NVIDIA A100-SXM4-80GB":              "AMPERE_80",
+	"NVIDIA H100 80GB HBM3":              "ADA_80_PRO",
+	"NVIDIA H100 PCIe":                   "ADA_80_PRO",
+	"NVIDIA H100 NVL":                    "ADA_80_PRO",
+	"NVIDIA H200":                        "HOPPER_141",
+}
+
+// currentGpuCatalog is the catalog loaded by this command, if any.
+var currentGpuCatalog *gpuCatalog
+
+// gpuType is a GPU type as listed by the gpuTypes query.
+type gpuType struct {
+	Id          string `json:"id"`
+	DisplayName string `json:"displayName"`
+	MemoryGb    int    `json:"memoryInGb"`
+}
+
+// gpuCatalog is the list of GPU types, cached in ~/.airfoil so gpu_types can
+// be validated offline.
+type gpuCatalog struct {
+	FetchedAt time.Time `json:"fetchedAt"`
+	GpuTypes  []gpuType `json:"gpuTypes"`
+}
+
+// resolvedGpu is an entry of gpu_types resolved to a GPU type, or to a whole
+// pool when the entry names one.
+type resolvedGpu struct {
+	Entry string
+	Id    string
+	Pool  string
+}
+
+func gpuCatalogPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("getting user home directory: %w", err)
+	}
+	return filepath.Join(home, ".airfoil", "gpu_types.json"), nil
+}
+
+// loadGpuCatalog returns the cached GPU types, fetching them again once the
+// cache is older than gpuCatalogMaxAge. Without an API key or network, the
+// stale cache is used, and the GPU types airfoil knows about without one.
+func loadGpuCatalog() *gpuCatalog {
+	if currentGpuCatalog == nil {
+		currentGpuCatalog = readGpuCatalog()
+	}
+	return currentGpuCatalog
+}
+
+func readGpuCatalog() *gpuCatalog {
+	cachePath, err := gpuCatalogPath()
+	cached := &gpuCatalog{}
+	if err == nil {
+		if content, err := os.ReadFile(cachePath); err == nil {
+			if err := json.Unmarshal(content, cached); err != nil {
+				cached = &gpuCatalog{}
+			}
+		}
+	}
+	if len(cached.GpuTypes) > 0 && time.Since(cached.FetchedAt) < gpuCatalogMaxAge {
+		return cached
+	}
+
+	if apiKeyConfigured() {
+		if fetched, err := fetchGpuCatalog(); err == nil {
+			if cachePath != "" {
+				if content, err := json.MarshalIndent(fetched, "", "  "); err == nil && os.MkdirAll(filepath.Dir(cachePath), 0755) == nil {
+					os.WriteFile(cachePath, content, 0644)
+				}
+			}
+			return fetched
+		}
+	}
+	if len(cached.GpuTypes) > 0 {
+		return cached
+	}
+	return builtinGpuCatalog()
+}
+
+func fetchGpuCatalog() (*gpuCatalog, error) {
+	rawTypes, err := api.GetCloud(&api.GetCloudInput{GpuCount: 1})
+	if err != nil {
+		return nil, err
+	}
+	catalog := &gpuCatalog{FetchedAt: time.Now().UTC()}
+	for _, raw := range rawTypes {
+		fields, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		entry := gpuType{}
+		entry.Id, _ = fields["id"].(string)
+		entry.DisplayName, _ = fields["displayName"].(string)
+		if memory, ok := fields["memoryInGb"].(float64); ok {
+			entry.MemoryGb = int(memory)
+		}
+		if entry.Id != "" && entry.Id != "unknown" {
+			catalog.GpuTypes = append(catalog.GpuTypes, entry)
+		}
+	}
+	if len(catalog.GpuTypes) == 0 {
+		return nil, errors.New("no GPU types returned")
+	}
+	return catalog, nil
+}
+
+func builtinGpuCatalog() *gpuCatalog {
+	ids := map[string]bool{}
+	for id := range gpuMemoryGb {
+		ids[id] = true
+	}
+	for id := range gpuPools {
+		ids[id] = true
+	}
+
+	catalog := &gpuCatalog{}
+	for id := range ids {
+		displayName := strings.TrimPrefix(strings.TrimPrefix(id, "NVIDIA "), "GeForce ")
+		catalog.GpuTypes = append(catalog.GpuTypes, gpuType{Id: id, DisplayName: displayName, MemoryGb: gpuMemoryGb[id]})
+	}
+	sort.Slice(catalog.GpuTypes, func(i, j int) bool { return catalog.GpuTypes[i].Id < catalog.GpuTypes[j].Id })
+	return catalog
+}
+
+// normalizeGpuName reduces a GPU name to the letters and digits that tell it
+// apart, so "RTX 4090", "NVIDIA GeForce RTX 4090" and "rtx4090" match.
+func normalizeGpuName(name string) string {
+	name = strings.ToLower(name)
+	name = strings.TrimPrefix(strings.TrimSpace(name), "nvidia ")
+	name = strings.TrimPrefix(name, "geforce ")
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+// all returns the GPU types of the catalog, followed by those airfoil knows
+// about that RunPod does not list at the moment.
+func (c *gpuCatalog) all() []gpuType {
+	gpus := append([]gpuType{}, c.GpuTypes...)
+	known := map[string]bool{}
+	for _, gpu := range gpus {
+		known[gpu.Id] = true
+	}
+	for _, gpu := range builtinGpuCatalog().GpuTypes {
+		if !known[gpu.Id] {
+			gpus = append(gpus, gpu)
+		}
+	}
+	return gpus
+}
+
+// resolve maps the gpu_types entries to GPU types or pools, keeping their
+// order. An entry is a GPU type id, its display name or a pool id. All
+// unknown entries are reported at once, with the closest known names.
+func (c *gpuCatalog) resolve(entries []string) ([]resolvedGpu, error) {
+	gpus := c.all()
+	byName := map[string]string{}
+	for _, gpu := range gpus {
+		for _, name := range []string{gpu.Id, gpu.DisplayName} {
+			key := normalizeGpuName(name)
+			if _, ok := byName[key]; !ok && key != "" {
+				byName[key] = gpu.Id
+			}
+		}
+	}
+	pools := map[string]string{}
+	for _, pool := range gpuPools {
+		pools[normalizeGpuName(pool)] = pool
+	}
+
+	resolved := []resolvedGpu{}
+	unknown := []string{}
+	for _, entry := range entries {
+		key := normalizeGpuName(entry)
+		if id, ok := byName[key]; ok {
+			resolved = append(resolved, resolvedGpu{Entry: entry, Id: id, Pool: gpuPools[id]})
+			continue
+		}
+		if pool, ok := pools[key]; ok {
+			resolved = append(resolved, resolvedGpu{Entry: entry, Pool: pool})
+			continue
+		}
+		message := fmt.Sprintf("%q", entry)
+		if suggestions := suggestGpuNames(entry, gpus); len(suggestions) > 0 {
+			message += ", did you mean " + strings.Join(suggestions, " or ") + "?"
+		}
+		unknown = append(unknown, message)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown GPU types in project.gpu_types:\n%s%s", inputPromptPrefix, strings.Join(unknown, "\n"+inputPromptPrefix))
+	}
+	return resolved, nil
+}
+
+// suggestGpuNames returns the ids of up to three GPU types whose id or
+// display name is close to name.
+func suggestGpuNames(name string, gpus []gpuType) []string {
+	type candidate struct {
+		id       string
+		distance int
+	}
+	key := normalizeGpuName(name)
+	if key == "" {
+		return nil
+	}
+	candidates := []candidate{}
+	for _, gpu := range gpus {
+		distance, similar := -1, false
+		for _, other := range []string{gpu.Id, gpu.DisplayName} {
+			otherKey := normalizeGpuName(other)
+			if otherKey == "" {
+				continue
+			}
+			d := levenshtein(key, otherKey)
+			if distance < 0 || d < distance {
+				distance = d
+			}
+			similar = similar || d <= max(2, len(key)/3) || strings.Contains(otherKey, key) || strings.Contains(key, otherKey)
+		}
+		if similar {
+			candidates = append(candidates, candidate{gpu.Id, distance})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].id < candidates[j].id
+	})
+
+	suggestions := []string{}
+	for _, candidate := range candidates {
+		if len(suggestions) == 3 {
+			break
+		}
+		suggestions = append(suggestions, fmt.Sprintf("%q", candidate.id))
+	}
+	return suggestions
+}
+
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// podGpuTypeIds returns the GPU type ids to try for a pod, in the order of
+// gpu_types. A pool stands for each of its GPU types.
+func podGpuTypeIds(config *ProjectConfig) ([]string, error) {
+	catalog := loadGpuCatalog()
+	resolved, err := catalog.resolve(config.Project.GpuTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	seen := map[string]bool{}
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, gpu := range resolved {
+		if gpu.Id != "" {
+			add(gpu.Id)
+			continue
+		}
+		for _, known := range catalog.all() {
+			if gpuPools[known.Id] == gpu.Pool {
+				add(known.Id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// endpointGpuIds returns the serverless pools of gpu_types, in the order of
+// their first GPU type. GPU types without a pool are skipped.
+func endpointGpuIds(config *ProjectConfig) (string, error) {
+	resolved, err := loadGpuCatalog().resolve(config.Project.GpuTypes)
+	if err != nil {
+		return "", err
+	}
+
+	pools := []string{}
+	seen := map[string]bool{}
+	for _, gpu := range resolved {
+		if gpu.Pool != "" && !seen[gpu.Pool] {
+			seen[gpu.Pool] = true
+			pools = append(pools, gpu.Pool)
+		}
+	}
+	if len(pools) == 0 {
+		return "", errors.New("none of project.gpu_types is available for serverless endpoints")
+	}
+	return strings.Join(pools, ","), nil
+}
@@ -0,0 +1,220 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/yourusername/airfoil/api"
+	"github.com/yourusername/airfoil/format"
+)
+
+// maxDeployHistory is the number of deploys kept per environment.
+const maxDeployHistory int = 50
+
+var deployHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the deploys of the environment",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := showDeployHistory(); err != nil {
+			fmt.Println("Failed to show deploy history:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var deployRollbackCmd = &cobra.Command{
+	Use:   "rollback [n]",
+	Short: "Point the endpoint back to the template of an earlier deploy",
+	Long: `Points the endpoint back to the template of the deploy n steps before the current
+one, as numbered by 'airfoil deploy history'. The default of 1 is the previous deploy.
+Only the template, that is the image and environment, is rolled back; endpoint settings
+such as workers and GPUs are left as they are.`,
+	Example: `  airfoil deploy rollback
+  airfoil deploy rollback 3 --environment production`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		steps := 1
+		if len(args) > 0 {
+			var err error
+			if steps, err = strconv.Atoi(args[0]); err != nil || steps < 1 {
+				fmt.Println("Failed to roll back: n must be a positive number")
+				os.Exit(1)
+			}
+		}
+		if err := rollbackDeploy(steps); err != nil {
+			fmt.Println("Failed to roll back:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	DeployProjectCmd.AddCommand(deployHistoryCmd)
+	DeployProjectCmd.AddCommand(deployRollbackCmd)
+
+	deployRollbackCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Roll back without asking for confirmation")
+}
+
+// recordDeploy appends a deploy to the history of the environment.
+func (s *ProjectState) recordDeploy(record DeployRecord) {
+	s.History = append(s.History, record)
+	if len(s.History) > maxDeployHistory {
+		s.History = s.History[len(s.History)-maxDeployHistory:]
+	}
+}
+
+// newDeployRecord describes a deploy of templateId made now, from revision,
+// by the local user.
+func newDeployRecord(revision gitRevision, endpointId, templateId, templateName, image string) DeployRecord {
+	return DeployRecord{
+		EndpointId:   endpointId,
+		TemplateId:   templateId,
+		TemplateName: templateName,
+		Image:        image,
+		User:         currentUserName(),
+		DeployedAt:   time.Now().UTC(),
+		gitRevision:  revision,
+	}
+}
+
+func currentUserName() string {
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return current.Username
+	}
+	return os.Getenv("USER")
+}
+
+func showDeployHistory() error {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	state, err := loadProjectState(config)
+	if err != nil {
+		return err
+	}
+	if len(state.History) == 0 {
+		fmt.Printf("No deploys recorded for environment %s\n", state.environment)
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"#", "Deployed", "Image", "Template", "Commit", "Branch", "User"})
+	format.TableDefaults(table)
+	for i := len(state.History) - 1; i >= 0; i-- {
+		record := state.History[i]
+		index := strconv.Itoa(len(state.History) - 1 - i)
+		if state.Endpoint != nil && record.TemplateId == state.Endpoint.TemplateId && i == len(state.History)-1 {
+			index += " (current)"
+		}
+		image := record.Image
+		if record.RollbackOf != "" {
+			image += " (rollback)"
+		}
+		commit := gitCommitURL(state.dir, record.Commit)
+		if commit == "" {
+			commit = record.Commit[:min(len(record.Commit), 12)]
+		}
+		if record.Dirty {
+			commit += " (dirty)"
+		}
+		if record.Tag != "" {
+			commit += " " + record.Tag
+		}
+		table.Append([]string{index, record.DeployedAt.Local().Format("2006-01-02 15:04"), image, record.TemplateId, commit, record.Branch, record.User})
+	}
+	table.Render()
+	return nil
+}
+
+func rollbackDeploy(steps int) error {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	state, err := loadProjectState(config)
+	if err != nil {
+		return err
+	}
+	if len(state.History) == 0 {
+		return fmt.Errorf("no deploys recorded for environment %s", state.environment)
+	}
+	if steps >= len(state.History) {
+		return fmt.Errorf("environment %s has %d earlier deploys", state.environment, len(state.History)-1)
+	}
+
+	endpoint, err := findProjectEndpoint(config, state)
+	if err != nil {
+		return err
+	}
+	if endpoint == nil {
+		return errors.New("the project endpoint no longer exists, run airfoil deploy")
+	}
+
+	target := state.History[len(state.History)-1-steps]
+	if target.TemplateId == endpoint.TemplateId {
+		fmt.Printf("Endpoint %s already uses template %s\n", endpoint.Id, target.TemplateId)
+		return nil
+	}
+
+	templates, err := api.GetTemplates()
+	if err != nil {
+		return fmt.Errorf("getting templates: %w", err)
+	}
+	found := false
+	for _, template := range templates {
+		found = found || template.Id == target.TemplateId
+	}
+	if !found {
+		return fmt.Errorf("template %s of that deploy no longer exists", target.TemplateId)
+	}
+
+	fmt.Printf("Endpoint %s uses template %s\n", endpoint.Id, endpoint.TemplateId)
+	fmt.Printf("Rolling back to template %s from %s\n", target.TemplateId, target.DeployedAt.Local().Format("2006-01-02 15:04"))
+	fmt.Printf("%sImage: %s\n", inputPromptPrefix, target.Image)
+	if target.Commit != "" {
+		fmt.Printf("%sCommit: %s\n", inputPromptPrefix, target.Commit)
+	}
+	if !assumeYes {
+		confirm := promptui.Prompt{Label: "Roll back the endpoint", IsConfirm: true}
+		if _, err := confirm.Run(); err != nil {
+			fmt.Println("Nothing was changed.")
+			return nil
+		}
+	}
+
+	if err := api.UpdateEndpointTemplate(endpoint.Id, target.TemplateId); err != nil {
+		return fmt.Errorf("updating endpoint %s: %w", endpoint.Id, err)
+	}
+
+	record := target
+	record.EndpointId = endpoint.Id
+	record.User = currentUserName()
+	record.DeployedAt = time.Now().UTC()
+	record.RollbackOf = endpoint.TemplateId
+	record.Tag = ""
+	state.recordDeploy(record)
+	state.Endpoint = &EndpointState{
+		Id:           endpoint.Id,
+		Name:         endpoint.Name,
+		TemplateId:   target.TemplateId,
+		TemplateName: target.TemplateName,
+		Image:        target.Image,
+		DeployedAt:   record.DeployedAt,
+		gitRevision:  target.gitRevision,
+	}
+	if err := state.save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Endpoint %s rolled back to %s\n", endpoint.Id, target.Image)
+	return nil
+}
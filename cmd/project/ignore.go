@@ -2,7 +2,9 @@ package project
 
 import (
 	"bufio"
+	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -16,15 +18,25 @@ var EXCLUDE_PATTERNS = []string{
 	".git/",
 	"*.tmp",
 	"*.log",
+	".runpod/",
+	// Local secrets never leave the machine, not even in a private image.
+	".env",
+	secretsFile,
 }
 
 func GetIgnoreList() ([]string, error) {
+	cwd, _ := os.Getwd()
+	return getIgnoreListFrom(cwd)
+}
+
+// getIgnoreListFrom returns EXCLUDE_PATTERNS followed by the patterns of the
+// .runpodignore file in dir.
+func getIgnoreListFrom(dir string) ([]string, error) {
 	// Reads the .runpodignore file and returns a list of files to ignore.
 	ignoreList := make([]string, len(EXCLUDE_PATTERNS))
 	copy(ignoreList, EXCLUDE_PATTERNS)
 
-	cwd, _ := os.Getwd()
-	ignoreFile := filepath.Join(cwd, ".runpodignore")
+	ignoreFile := filepath.Join(dir, ".runpodignore")
 
 	file, err := os.Open(ignoreFile)
 	if err != nil {
@@ -50,6 +62,30 @@ func GetIgnoreList() ([]string, error) {
 	return ignoreList, nil
 }
 
+// projectIgnoreList returns the ignore list of the project, including its
+// env_file when that is inside the project folder.
+func projectIgnoreList(config *ProjectConfig) ([]string, error) {
+	ignoreList, err := getIgnoreListFrom(config.Dir())
+	if err != nil {
+		return nil, err
+	}
+
+	if envFile := config.Project.EnvFile; envFile != "" {
+		if filepath.IsAbs(envFile) {
+			relPath, err := filepath.Rel(config.Dir(), envFile)
+			if err != nil {
+				return ignoreList, nil
+			}
+			envFile = relPath
+		}
+		envFile = path.Clean(filepath.ToSlash(envFile))
+		if envFile != ".." && !strings.HasPrefix(envFile, "../") {
+			ignoreList = append(ignoreList, "/"+envFile)
+		}
+	}
+	return ignoreList, nil
+}
+
 func ShouldIgnore(filePath string, ignoreList []string) (bool, error) {
 	if ignoreList == nil {
 		var err error
@@ -90,3 +126,59 @@ func ShouldIgnore(filePath string, ignoreList []string) (bool, error) {
 
 	return false, nil
 }
+
+// ignorePattern is a compiled .runpodignore pattern, matched the way rsync
+// matches --exclude patterns.
+type ignorePattern struct {
+	glob     glob.Glob
+	anchored bool
+	dirOnly  bool
+}
+
+// ignoreMatcher matches slash-separated paths relative to the project
+// directory against an ignore list.
+type ignoreMatcher struct {
+	patterns []ignorePattern
+}
+
+func newIgnoreMatcher(ignoreList []string) (*ignoreMatcher, error) {
+	matcher := &ignoreMatcher{}
+	for _, pattern := range ignoreList {
+		compiled := ignorePattern{}
+		if strings.HasSuffix(pattern, "/") {
+			compiled.dirOnly = true
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		// Patterns containing a slash match the whole path, others match any path component.
+		if strings.Contains(pattern, "/") {
+			compiled.anchored = true
+			pattern = strings.TrimPrefix(pattern, "/")
+		}
+
+		g, err := glob.Compile(pattern, '/')
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q: %w", pattern, err)
+		}
+		compiled.glob = g
+		matcher.patterns = append(matcher.patterns, compiled)
+	}
+	return matcher, nil
+}
+
+// Match reports whether relPath is ignored. A directory that matches
+// excludes everything below it.
+func (m *ignoreMatcher) Match(relPath string, isDir bool) bool {
+	for _, pattern := range m.patterns {
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+		if pattern.anchored {
+			if pattern.glob.Match(relPath) {
+				return true
+			}
+		} else if pattern.glob.Match(path.Base(relPath)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,573 @@
+package project
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	imageBaseLayout string
+	imageBaseRef    string
+	imagePlatform   string
+	imageOutput     string
+	imageFormat     string
+	imageTag        string
+	pushLayout      string
+	pushRef         string
+	pushChunkSizeMb int
+	pushPlainHTTP   bool
+)
+
+var ImageCmd = &cobra.Command{
+	Use:   "image",
+	Short: "Assemble and publish project images without a container daemon",
+}
+
+var imageBuildCmd = &cobra.Command{
+	Use:   "build",
+	Short: "Assemble the project image from a base image in an OCI layout",
+	Long: `Assembles the project image in pure Go, without docker or any other daemon.
+The base image is read from an OCI image layout directory, for example one written by
+'skopeo copy docker://runpod/base:0.6.1-cuda12.5.0 oci:base'. A layer with the project
+source, built from the same reproducible context as 'build --context-only', is added
+on top, and the image config gets the env_vars, working directory and handler command
+from runpod.toml. Dependencies are not installed, so the base image must already
+contain them.
+
+The result is written as an OCI layout directory or a docker-archive tarball that
+'docker load' and 'podman load' accept.`,
+	Example: `  airfoil image build --base ./base --tag registry.example.com/acme/my-worker:v1
+  airfoil image build --base ./base --format docker-archive --output my-worker.tar`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := buildProjectOCIImage(); err != nil {
+			fmt.Println("Failed to build image:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var imagePushCmd = &cobra.Command{
+	Use:   "push [destination]",
+	Short: "Push an image from an OCI layout to a registry",
+	Long: `Uploads an image from an OCI layout to any registry over the Distribution v2 API.
+Blobs the registry already has are skipped, and large blobs are uploaded in chunks;
+an interrupted push resumes where it stopped when run again. Credentials are read
+from docker's config.json, including credential helpers, so log in with docker login.
+
+By default the image of the last 'airfoil image build' is pushed to its tag. The
+pushed digest is recorded for deploy.`,
+	Example: `  airfoil image push
+  airfoil image push registry.example.com/acme/my-worker:v1
+  airfoil image push --layout ./out --ref my-worker:latest localhost:5000/my-worker:dev`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		destination := ""
+		if len(args) > 0 {
+			destination = args[0]
+		}
+		if err := pushProjectImage(destination); err != nil {
+			fmt.Println("Failed to push image:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	ImageCmd.AddCommand(imageBuildCmd)
+	ImageCmd.AddCommand(imagePushCmd)
+
+	imageBuildCmd.Flags().StringVar(&imageBaseLayout, "base", "", "OCI layout directory holding the base image")
+	imageBuildCmd.Flags().StringVar(&imageBaseRef, "base-ref", "", "Ref of the base image in the layout, when it holds several")
+	imageBuildCmd.Flags().StringVar(&imagePlatform, "platform", "linux/amd64", "Platform to pick from a multi-platform base image")
+	imageBuildCmd.Flags().StringVarP(&imageOutput, "output", "o", "", "Output path (default is .runpod/image, or .runpod/image.tar for docker-archive)")
+	imageBuildCmd.Flags().StringVar(&imageFormat, "format", "oci", "Output format: oci or docker-archive")
+	imageBuildCmd.Flags().StringVarP(&imageTag, "tag", "t", "", "Tag for the image (default is <name>:latest)")
+	imageBuildCmd.MarkFlagRequired("base")
+
+	imagePushCmd.Flags().StringVar(&pushLayout, "layout", "", "OCI layout directory to push from (default is the output of the last image build)")
+	imagePushCmd.Flags().StringVar(&pushRef, "ref", "", "Ref of the image in the layout (default is the tag of the last image build)")
+	imagePushCmd.Flags().StringVar(&imagePlatform, "platform", "linux/amd64", "Platform to push from a multi-platform image")
+	imagePushCmd.Flags().IntVar(&pushChunkSizeMb, "chunk-size", 16, "Upload chunk size in MiB")
+	imagePushCmd.Flags().BoolVar(&pushPlainHTTP, "plain-http", false, "Talk to the registry over HTTP instead of HTTPS (always used for localhost)")
+}
+
+func buildProjectOCIImage() error {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	if imageFormat != "oci" && imageFormat != "docker-archive" {
+		return fmt.Errorf("unknown format %q, use oci or docker-archive", imageFormat)
+	}
+	platform, err := parsePlatform(imagePlatform)
+	if err != nil {
+		return err
+	}
+
+	tag := imageTag
+	if tag == "" {
+		tag = config.Name + ":latest"
+	}
+	output := imageOutput
+	if output == "" {
+		output = filepath.Join(config.Dir(), ".runpod", "image")
+		if imageFormat == "docker-archive" {
+			output += ".tar"
+		}
+	}
+
+	if len(config.Runtime.SystemPackages) > 0 || len(config.Runtime.BuildSteps) > 0 {
+		fmt.Printf("%sruntime.system_packages and runtime.build_steps are not applied, the base image must already include them\n", inputPromptPrefix)
+	}
+
+	base, err := openOCILayout(imageBaseLayout)
+	if err != nil {
+		return err
+	}
+
+	layoutDir := output
+	if imageFormat == "docker-archive" {
+		if layoutDir, err = os.MkdirTemp("", "airfoil-image-"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(layoutDir)
+	}
+	out, err := createOCILayout(layoutDir)
+	if err != nil {
+		return err
+	}
+
+	revision := currentGitRevision(config.Dir())
+	desc, manifest, err := assembleProjectImage(config, base, imageBaseRef, platform, out, tag)
+	if err != nil {
+		return err
+	}
+
+	if imageFormat == "docker-archive" {
+		if err := writeDockerArchive(output, out, desc, manifest, tag); err != nil {
+			return err
+		}
+	}
+
+	state, err := loadProjectState(config)
+	if err != nil {
+		return err
+	}
+	state.Image = &ImageState{Tag: tag, Builder: "airfoil", BuiltAt: time.Now().UTC(), Digest: desc.Digest, gitRevision: revision}
+	if imageFormat == "oci" {
+		if state.Image.Layout, err = filepath.Abs(output); err != nil {
+			return err
+		}
+	}
+	if err := state.save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %s image %s to %s\n", imageFormat, tag, output)
+	fmt.Printf("%sDigest: %s\n", inputPromptPrefix, desc.Digest)
+	return nil
+}
+
+func pushProjectImage(destination string) error {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	state, err := loadProjectState(config)
+	if err != nil {
+		return err
+	}
+
+	layoutDir, sourceRef := pushLayout, pushRef
+	if layoutDir == "" {
+		if state.Image == nil || state.Image.Layout == "" {
+			return errors.New("no image layout to push, run airfoil image build first or pass --layout")
+		}
+		layoutDir = state.Image.Layout
+		if sourceRef == "" {
+			sourceRef = state.Image.Tag
+		}
+	}
+	if destination == "" {
+		destination = sourceRef
+	}
+	if destination == "" {
+		return errors.New("no destination given")
+	}
+	if pushChunkSizeMb < 1 {
+		return errors.New("chunk size must be at least 1 MiB")
+	}
+
+	platform, err := parsePlatform(imagePlatform)
+	if err != nil {
+		return err
+	}
+	ref, err := parseImageReference(destination)
+	if err != nil {
+		return err
+	}
+	if ref.Digest != "" {
+		return fmt.Errorf("destination %s must not contain a digest", destination)
+	}
+
+	layout, err := openOCILayout(layoutDir)
+	if err != nil {
+		return err
+	}
+	desc, manifest, err := layout.resolveImage(sourceRef, platform)
+	if err != nil {
+		return err
+	}
+	manifestBlob, err := layout.readBlob(desc.Digest)
+	if err != nil {
+		return err
+	}
+
+	client, err := newRegistryClient(ref, pushPlainHTTP, int64(pushChunkSizeMb)<<20)
+	if err != nil {
+		return err
+	}
+	sessions := loadUploadSessions(filepath.Join(config.Dir(), ".runpod", "uploads.json"))
+
+	fmt.Printf("Pushing %s to %s\n", desc.Digest, ref)
+	if err := pushImageBlobs(client, layout, manifest, sessions); err != nil {
+		return err
+	}
+
+	digest, err := client.putManifest(desc.MediaType, manifestBlob)
+	if err != nil {
+		return err
+	}
+	// Tag the pushed image in the layout as well, so a later push without
+	// arguments finds it under the recorded tag.
+	if destination != sourceRef {
+		if err := layout.tagManifest(desc, destination); err != nil {
+			return err
+		}
+	}
+
+	absLayout, err := filepath.Abs(layoutDir)
+	if err != nil {
+		return err
+	}
+	// An image pushed from a layout airfoil did not build here has no known
+	// git revision.
+	if state.Image == nil || state.Image.Layout != absLayout {
+		state.Image = &ImageState{Builder: "airfoil", BuiltAt: time.Now().UTC()}
+	}
+	state.Image.Tag = destination
+	state.Image.Digest = digest
+	state.Image.Pushed = true
+	state.Image.Layout = absLayout
+	if err := state.save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Pushed %s\n", state.Image.Reference())
+	return nil
+}
+
+// pushImageBlobs uploads the layers and config of manifest that the registry
+// does not have yet.
+func pushImageBlobs(client *registryClient, layout *ociLayout, manifest *ociManifest, sessions *uploadSessions) error {
+	for _, blob := range append(append([]ociDescriptor{}, manifest.Layers...), manifest.Config) {
+		exists, err := client.blobExists(blob.Digest)
+		if err != nil {
+			return err
+		}
+		if exists {
+			fmt.Printf("%s%s exists\n", inputPromptPrefix, shortDigest(blob.Digest))
+			continue
+		}
+
+		blobPath, err := layout.blobPath(blob.Digest)
+		if err != nil {
+			return err
+		}
+		if err := client.uploadBlob(blobPath, blob.Digest, sessions); err != nil {
+			return err
+		}
+		fmt.Printf("%s%s pushed (%s)\n", inputPromptPrefix, shortDigest(blob.Digest), formatBytes(blob.Size))
+	}
+	return nil
+}
+
+// assembleProjectImage writes the project image into out: the layers of the
+// base image, a layer with the project source and an updated config.
+func assembleProjectImage(config *ProjectConfig, base *ociLayout, baseRef string, platform ociPlatform, out *ociLayout, tag string) (ociDescriptor, *ociManifest, error) {
+	_, baseManifest, err := base.resolveImage(baseRef, platform)
+	if err != nil {
+		return ociDescriptor{}, nil, err
+	}
+	baseConfig, err := base.readBlob(baseManifest.Config.Digest)
+	if err != nil {
+		return ociDescriptor{}, nil, err
+	}
+
+	imageConfig := map[string]any{}
+	if err := json.Unmarshal(baseConfig, &imageConfig); err != nil {
+		return ociDescriptor{}, nil, fmt.Errorf("parsing base image config: %w", err)
+	}
+
+	layers := []ociDescriptor{}
+	for _, layer := range baseManifest.Layers {
+		if err := out.copyBlob(base, layer.Digest); err != nil {
+			return ociDescriptor{}, nil, err
+		}
+		if layer.MediaType == mediaTypeDockerLayer {
+			layer.MediaType = mediaTypeOCILayer
+		}
+		layers = append(layers, layer)
+	}
+
+	sourceLayer, diffID, err := writeSourceLayer(config, out)
+	if err != nil {
+		return ociDescriptor{}, nil, err
+	}
+	layers = append(layers, sourceLayer)
+
+	if err := updateImageConfig(config, imageConfig, diffID); err != nil {
+		return ociDescriptor{}, nil, err
+	}
+	configBlob, err := json.Marshal(imageConfig)
+	if err != nil {
+		return ociDescriptor{}, nil, err
+	}
+	configDigest, err := out.writeBlob(configBlob)
+	if err != nil {
+		return ociDescriptor{}, nil, err
+	}
+
+	manifest := &ociManifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeOCIImage,
+		Config:        ociDescriptor{MediaType: mediaTypeOCIConfig, Digest: configDigest, Size: int64(len(configBlob))},
+		Layers:        layers,
+	}
+	manifestBlob, err := json.Marshal(manifest)
+	if err != nil {
+		return ociDescriptor{}, nil, err
+	}
+	manifestDigest, err := out.writeBlob(manifestBlob)
+	if err != nil {
+		return ociDescriptor{}, nil, err
+	}
+
+	desc := ociDescriptor{MediaType: mediaTypeOCIImage, Digest: manifestDigest, Size: int64(len(manifestBlob)), Platform: &platform}
+	if err := out.tagManifest(desc, tag); err != nil {
+		return ociDescriptor{}, nil, err
+	}
+	return desc, manifest, nil
+}
+
+// writeSourceLayer stores the project source as a gzipped layer in out and
+// returns its descriptor and the digest of the uncompressed tar.
+func writeSourceLayer(config *ProjectConfig, out *ociLayout) (ociDescriptor, string, error) {
+	entries, err := collectBuildContext(config)
+	if err != nil {
+		return ociDescriptor{}, "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(out.dir, "blobs"), ".layer-*")
+	if err != nil {
+		return ociDescriptor{}, "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(tmp, hash)}
+	gz := gzip.NewWriter(counter)
+	summary, err := writeBuildContext(gz, config.Dir(), entries, nil)
+	if err != nil {
+		return ociDescriptor{}, "", err
+	}
+	if err := gz.Close(); err != nil {
+		return ociDescriptor{}, "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return ociDescriptor{}, "", err
+	}
+
+	digest := "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	if err := out.importBlob(tmp.Name(), digest); err != nil {
+		return ociDescriptor{}, "", err
+	}
+
+	fmt.Printf("%sSource layer: %d files, %s\n", inputPromptPrefix, summary.Files, formatBytes(counter.n))
+	return ociDescriptor{MediaType: mediaTypeOCILayer, Digest: digest, Size: counter.n}, summary.Digest, nil
+}
+
+// updateImageConfig applies runpod.toml to the image config the way the
+// generated Dockerfile would, and records the source layer.
+func updateImageConfig(config *ProjectConfig, imageConfig map[string]any, diffID string) error {
+	handlerPath, err := validateProjectFile(config, "runtime.handler_path", config.Runtime.HandlerPath)
+	if err != nil {
+		return err
+	}
+	if !pythonVersionFormat.MatchString(config.Runtime.PythonVersion) {
+		return fmt.Errorf("invalid runtime.python_version %q, expected a version such as 3.10", config.Runtime.PythonVersion)
+	}
+	envVars, err := imageEnvVars(config)
+	if err != nil {
+		return err
+	}
+
+	containerConfig, _ := imageConfig["config"].(map[string]any)
+	if containerConfig == nil {
+		containerConfig = map[string]any{}
+	}
+
+	env := []any{}
+	overridden := map[string]bool{}
+	for _, envVar := range envVars {
+		overridden[envVar.Key] = true
+	}
+	if existing, ok := containerConfig["Env"].([]any); ok {
+		for _, entry := range existing {
+			key, _, _ := strings.Cut(fmt.Sprint(entry), "=")
+			if !overridden[key] {
+				env = append(env, entry)
+			}
+		}
+	}
+	for _, envVar := range envVars {
+		env = append(env, envVar.Key+"="+envVar.Value)
+	}
+	containerConfig["Env"] = env
+	containerConfig["WorkingDir"] = "/"
+	containerConfig["Cmd"] = []any{"python" + config.Runtime.PythonVersion, "-u", "/" + handlerPath}
+	imageConfig["config"] = containerConfig
+
+	created := imageCreatedTime().Format(time.RFC3339)
+	imageConfig["created"] = created
+
+	rootfs, _ := imageConfig["rootfs"].(map[string]any)
+	if rootfs == nil {
+		rootfs = map[string]any{"type": "layers"}
+	}
+	diffIDs, _ := rootfs["diff_ids"].([]any)
+	rootfs["diff_ids"] = append(diffIDs, diffID)
+	imageConfig["rootfs"] = rootfs
+
+	history, _ := imageConfig["history"].([]any)
+	imageConfig["history"] = append(history, map[string]any{
+		"created":    created,
+		"created_by": "airfoil image build",
+		"comment":    "project source of " + config.Name,
+	})
+	return nil
+}
+
+// imageCreatedTime honors SOURCE_DATE_EPOCH so the same source always gives
+// the same image digest.
+func imageCreatedTime() time.Time {
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC()
+	}
+	return contextEpoch
+}
+
+// writeDockerArchive writes an image of layout as a tarball that holds both
+// an OCI layout and the manifest.json read by docker load.
+func writeDockerArchive(path string, layout *ociLayout, desc ociDescriptor, manifest *ociManifest, tag string) error {
+	index := ociIndex{SchemaVersion: 2, MediaType: mediaTypeOCIIndex, Manifests: []ociDescriptor{desc}}
+	index.Manifests[0].Annotations = map[string]string{ociRefNameKey: tag, "io.containerd.image.name": tag}
+	indexBlob, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	dockerManifest := []map[string]any{{
+		"Config":   "blobs/sha256/" + strings.TrimPrefix(manifest.Config.Digest, "sha256:"),
+		"RepoTags": []string{tag},
+		"Layers":   []string{},
+	}}
+	layerPaths := []string{}
+	for _, layer := range manifest.Layers {
+		layerPaths = append(layerPaths, "blobs/sha256/"+strings.TrimPrefix(layer.Digest, "sha256:"))
+	}
+	dockerManifest[0]["Layers"] = layerPaths
+	dockerManifestBlob, err := json.Marshal(dockerManifest)
+	if err != nil {
+		return err
+	}
+
+	digests := []string{desc.Digest, manifest.Config.Digest}
+	for _, layer := range manifest.Layers {
+		digests = append(digests, layer.Digest)
+	}
+	sort.Strings(digests)
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	tw := tar.NewWriter(file)
+
+	writeEntry := func(name string, size int64, content io.Reader) error {
+		header := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: size, ModTime: contextEpoch, Format: tar.FormatPAX}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, content)
+		return err
+	}
+
+	layoutMarker := []byte(`{"imageLayoutVersion":"1.0.0"}`)
+	if err := writeEntry(ociLayoutFile, int64(len(layoutMarker)), strings.NewReader(string(layoutMarker))); err != nil {
+		return err
+	}
+	if err := writeEntry(ociIndexFile, int64(len(indexBlob)), strings.NewReader(string(indexBlob))); err != nil {
+		return err
+	}
+	if err := writeEntry("manifest.json", int64(len(dockerManifestBlob)), strings.NewReader(string(dockerManifestBlob))); err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	for _, digest := range digests {
+		if seen[digest] {
+			continue
+		}
+		seen[digest] = true
+
+		blobPath, err := layout.blobPath(digest)
+		if err != nil {
+			return err
+		}
+		blob, err := os.Open(blobPath)
+		if err != nil {
+			return err
+		}
+		info, err := blob.Stat()
+		if err == nil {
+			err = writeEntry("blobs/sha256/"+strings.TrimPrefix(digest, "sha256:"), info.Size(), blob)
+		}
+		blob.Close()
+		if err != nil {
+			return fmt.Errorf("archiving blob %s: %w", digest, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
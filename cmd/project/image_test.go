@@ -0,0 +1,385 @@
+package project
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testBaseImage is a base image written by writeTestBaseLayout.
+type testBaseImage struct {
+	layout *ociLayout
+	ref    string
+	layer  ociDescriptor
+	diffID string
+}
+
+// testLayer returns a gzipped layer holding a single file, and the digest
+// of its uncompressed tar.
+func testLayer(t *testing.T, name, content string) ([]byte, string) {
+	t.Helper()
+	var plain bytes.Buffer
+	tw := tar.NewWriter(&plain)
+	if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0755, Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write(plain.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return compressed.Bytes(), sha256Digest(plain.Bytes())
+}
+
+func writeTestJSON(t *testing.T, layout *ociLayout, value any) (string, int64) {
+	t.Helper()
+	content, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := layout.writeBlob(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return digest, int64(len(content))
+}
+
+// writeTestBaseLayout writes a minimal base image layout: one layer and a
+// config with an environment. With multiPlatform the image is an index with
+// an arm64 and an amd64 variant; with docker the manifest uses the docker
+// media types skopeo keeps for docker registries.
+func writeTestBaseLayout(t *testing.T, multiPlatform, docker bool) testBaseImage {
+	t.Helper()
+	layout, err := createOCILayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifestType, layerType := mediaTypeOCIImage, mediaTypeOCILayer
+	if docker {
+		manifestType, layerType = mediaTypeDockerManifest, mediaTypeDockerLayer
+	}
+
+	image := func(arch string) (ociDescriptor, ociDescriptor, string) {
+		layerBlob, diffID := testLayer(t, "usr/bin/python3.10", "#!/bin/true "+arch)
+		layerDigest, err := layout.writeBlob(layerBlob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		layer := ociDescriptor{MediaType: layerType, Digest: layerDigest, Size: int64(len(layerBlob))}
+
+		configDigest, configSize := writeTestJSON(t, layout, map[string]any{
+			"architecture": arch,
+			"os":           "linux",
+			"config": map[string]any{
+				"Env":        []string{"PATH=/usr/local/bin:/usr/bin", "HF_HOME=/cache"},
+				"WorkingDir": "/workspace",
+				"Cmd":        []string{"/bin/bash"},
+			},
+			"rootfs":  map[string]any{"type": "layers", "diff_ids": []string{diffID}},
+			"history": []map[string]any{{"created_by": "base"}},
+		})
+		manifestDigest, manifestSize := writeTestJSON(t, layout, ociManifest{
+			SchemaVersion: 2,
+			MediaType:     manifestType,
+			Config:        ociDescriptor{MediaType: mediaTypeOCIConfig, Digest: configDigest, Size: configSize},
+			Layers:        []ociDescriptor{layer},
+		})
+		desc := ociDescriptor{MediaType: manifestType, Digest: manifestDigest, Size: manifestSize, Platform: &ociPlatform{OS: "linux", Architecture: arch}}
+		return desc, layer, diffID
+	}
+
+	base := testBaseImage{layout: layout, ref: "0.6.1"}
+	desc, layer, diffID := image("amd64")
+	base.layer, base.diffID = layer, diffID
+	if multiPlatform {
+		armDesc, _, _ := image("arm64")
+		indexDigest, indexSize := writeTestJSON(t, layout, ociIndex{
+			SchemaVersion: 2,
+			MediaType:     mediaTypeOCIIndex,
+			Manifests:     []ociDescriptor{armDesc, desc},
+		})
+		desc = ociDescriptor{MediaType: mediaTypeOCIIndex, Digest: indexDigest, Size: indexSize}
+	}
+	if err := layout.tagManifest(desc, base.ref); err != nil {
+		t.Fatal(err)
+	}
+	return base
+}
+
+// writeTestProject writes a project with a handler and returns its config.
+func writeTestProject(t *testing.T) *ProjectConfig {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"src/handler.py":           "import runpod\n",
+		"builder/requirements.txt": "runpod\n",
+		".env":                     "HF_TOKEN=hf_secret\n",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := &ProjectConfig{Name: "worker", dir: dir}
+	config.Runtime.PythonVersion = "3.10"
+	config.Runtime.HandlerPath = "src/handler.py"
+	config.Project.EnvVars = map[string]string{"MODEL": "gpt2", "HF_HOME": "/models"}
+	return config
+}
+
+// readLayerFiles returns the names of the files in a gzipped layer blob and
+// the digest of the uncompressed tar.
+func readLayerFiles(t *testing.T, blob []byte) ([]string, string) {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	tr := tar.NewReader(bytes.NewReader(plain))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			names = append(names, header.Name)
+		}
+	}
+	return names, sha256Digest(plain)
+}
+
+func TestAssembleProjectImage(t *testing.T) {
+	tests := []struct {
+		name          string
+		multiPlatform bool
+		docker        bool
+		baseRef       string
+	}{
+		{name: "oci manifest", baseRef: "0.6.1"},
+		{name: "only image without ref", baseRef: ""},
+		{name: "multi-platform index", multiPlatform: true, baseRef: "0.6.1"},
+		{name: "docker media types", docker: true, baseRef: "0.6.1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("SOURCE_DATE_EPOCH", "")
+			base := writeTestBaseLayout(t, test.multiPlatform, test.docker)
+			config := writeTestProject(t)
+			out, err := createOCILayout(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			platform := ociPlatform{OS: "linux", Architecture: "amd64"}
+			desc, manifest, err := assembleProjectImage(config, base.layout, test.baseRef, platform, out, "worker:v1")
+			if err != nil {
+				t.Fatalf("assembleProjectImage: %v", err)
+			}
+
+			// Layers: the base layer, as an OCI layer, then the source.
+			if len(manifest.Layers) != 2 {
+				t.Fatalf("image has %d layers, want 2", len(manifest.Layers))
+			}
+			wantBase := base.layer
+			wantBase.MediaType = mediaTypeOCILayer
+			if !reflect.DeepEqual(manifest.Layers[0], wantBase) {
+				t.Errorf("base layer = %+v, want %+v", manifest.Layers[0], wantBase)
+			}
+			source := manifest.Layers[1]
+			sourceBlob, err := out.readBlob(source.Digest)
+			if err != nil {
+				t.Fatalf("source layer: %v", err)
+			}
+			if source.MediaType != mediaTypeOCILayer || source.Size != int64(len(sourceBlob)) {
+				t.Errorf("source layer descriptor = %+v, blob is %d bytes", source, len(sourceBlob))
+			}
+			files, sourceDiffID := readLayerFiles(t, sourceBlob)
+			if want := []string{"builder/requirements.txt", "src/handler.py"}; !reflect.DeepEqual(files, want) {
+				t.Errorf("source layer files = %q, want %q", files, want)
+			}
+
+			// Config: runpod.toml applied on top of the base config.
+			configBlob, err := out.readBlob(manifest.Config.Digest)
+			if err != nil {
+				t.Fatalf("config: %v", err)
+			}
+			var imageConfig struct {
+				Architecture string `json:"architecture"`
+				Config       struct {
+					Env        []string
+					WorkingDir string
+					Cmd        []string
+				} `json:"config"`
+				Rootfs struct {
+					DiffIDs []string `json:"diff_ids"`
+				} `json:"rootfs"`
+			}
+			if err := json.Unmarshal(configBlob, &imageConfig); err != nil {
+				t.Fatal(err)
+			}
+			if imageConfig.Architecture != "amd64" {
+				t.Errorf("config is of the %s image, want amd64", imageConfig.Architecture)
+			}
+			wantEnv := []string{"PATH=/usr/local/bin:/usr/bin", "HF_HOME=/models", "MODEL=gpt2"}
+			if !reflect.DeepEqual(imageConfig.Config.Env, wantEnv) {
+				t.Errorf("Env = %q, want %q", imageConfig.Config.Env, wantEnv)
+			}
+			if imageConfig.Config.WorkingDir != "/" {
+				t.Errorf("WorkingDir = %q, want /", imageConfig.Config.WorkingDir)
+			}
+			if wantCmd := []string{"python3.10", "-u", "/src/handler.py"}; !reflect.DeepEqual(imageConfig.Config.Cmd, wantCmd) {
+				t.Errorf("Cmd = %q, want %q", imageConfig.Config.Cmd, wantCmd)
+			}
+			if wantDiffIDs := []string{base.diffID, sourceDiffID}; !reflect.DeepEqual(imageConfig.Rootfs.DiffIDs, wantDiffIDs) {
+				t.Errorf("diff_ids = %q, want %q", imageConfig.Rootfs.DiffIDs, wantDiffIDs)
+			}
+
+			// index.json: the manifest under the tag.
+			index, err := out.readIndex()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(index.Manifests) != 1 || index.Manifests[0].Digest != desc.Digest || index.Manifests[0].Annotations[ociRefNameKey] != "worker:v1" {
+				t.Errorf("index.json manifests = %+v, want %s tagged worker:v1", index.Manifests, desc.Digest)
+			}
+			manifestBlob, err := out.readBlob(desc.Digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if desc.Size != int64(len(manifestBlob)) || desc.MediaType != mediaTypeOCIImage {
+				t.Errorf("manifest descriptor = %+v, blob is %d bytes", desc, len(manifestBlob))
+			}
+
+			// The same source gives the same image.
+			again, err := createOCILayout(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			desc2, _, err := assembleProjectImage(config, base.layout, test.baseRef, platform, again, "worker:v1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if desc2.Digest != desc.Digest {
+				t.Errorf("rebuilt image digest %s, want %s", desc2.Digest, desc.Digest)
+			}
+		})
+	}
+}
+
+func TestWriteDockerArchive(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	base := writeTestBaseLayout(t, false, false)
+	config := writeTestProject(t)
+	out, err := createOCILayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, manifest, err := assembleProjectImage(config, base.layout, base.ref, ociPlatform{OS: "linux", Architecture: "amd64"}, out, "worker:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := filepath.Join(t.TempDir(), "image.tar")
+	if err := writeDockerArchive(archivePath, out, desc, manifest, "worker:v1"); err != nil {
+		t.Fatalf("writeDockerArchive: %v", err)
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	entries := map[string][]byte{}
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[header.Name] = content
+	}
+
+	blobName := func(digest string) string { return "blobs/sha256/" + strings.TrimPrefix(digest, "sha256:") }
+	var dockerManifest []struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}
+	if err := json.Unmarshal(entries["manifest.json"], &dockerManifest); err != nil {
+		t.Fatalf("manifest.json: %v", err)
+	}
+	if len(dockerManifest) != 1 {
+		t.Fatalf("manifest.json has %d images, want 1", len(dockerManifest))
+	}
+	image := dockerManifest[0]
+	if image.Config != blobName(manifest.Config.Digest) {
+		t.Errorf("Config = %s, want %s", image.Config, blobName(manifest.Config.Digest))
+	}
+	if !reflect.DeepEqual(image.RepoTags, []string{"worker:v1"}) {
+		t.Errorf("RepoTags = %q, want [worker:v1]", image.RepoTags)
+	}
+	wantLayers := []string{blobName(manifest.Layers[0].Digest), blobName(manifest.Layers[1].Digest)}
+	if !reflect.DeepEqual(image.Layers, wantLayers) {
+		t.Errorf("Layers = %q, want %q", image.Layers, wantLayers)
+	}
+
+	for _, name := range append([]string{image.Config, blobName(desc.Digest), ociLayoutFile}, image.Layers...) {
+		if _, ok := entries[name]; !ok {
+			t.Errorf("archive has no %s", name)
+		}
+	}
+	for name, content := range entries {
+		if strings.HasPrefix(name, "blobs/sha256/") {
+			if digest := sha256Digest(content); blobName(digest) != name {
+				t.Errorf("blob %s has digest %s", name, digest)
+			}
+		}
+	}
+
+	var index ociIndex
+	if err := json.Unmarshal(entries[ociIndexFile], &index); err != nil {
+		t.Fatalf("index.json: %v", err)
+	}
+	if len(index.Manifests) != 1 || index.Manifests[0].Digest != desc.Digest || index.Manifests[0].Annotations[ociRefNameKey] != "worker:v1" {
+		t.Errorf("index.json manifests = %+v, want %s tagged worker:v1", index.Manifests, desc.Digest)
+	}
+}
@@ -7,7 +7,14 @@ import (
 // InitializeCommands adds all project-related commands to the root command
 func InitializeCommands(rootCmd *cobra.Command) {
 	rootCmd.AddCommand(NewProjectCmd)
+	rootCmd.AddCommand(InitProjectCmd)
 	rootCmd.AddCommand(StartProjectCmd)
 	rootCmd.AddCommand(DeployProjectCmd)
 	rootCmd.AddCommand(BuildProjectCmd)
+	rootCmd.AddCommand(SecretsCmd)
+	rootCmd.AddCommand(TemplatesCmd)
+	rootCmd.AddCommand(EstimateCmd)
+	rootCmd.AddCommand(ImageCmd)
+	rootCmd.AddCommand(StateCmd)
+	rootCmd.AddCommand(DestroyProjectCmd)
 }
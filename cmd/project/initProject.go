@@ -0,0 +1,309 @@
+package project
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+)
+
+var (
+	initProjectName string
+	initCudaVersion string
+	assumeYes       bool
+)
+
+var InitProjectCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Adopt the existing code in the current folder as a project",
+	Long: `Scans the current folder for a RunPod handler, requirements file, Python version hints
+and an existing Dockerfile, then proposes and writes a runpod.toml and .runpodignore.
+Existing files are never overwritten.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := initProject(initProjectName, initCudaVersion); err != nil {
+			fmt.Println("Failed to initialize project:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	InitProjectCmd.Flags().StringVarP(&initProjectName, "name", "n", "", "Set the project name (default is the name of the current folder)")
+	InitProjectCmd.Flags().StringVarP(&initCudaVersion, "cuda", "c", "12.5", "Specify the CUDA version for the project when no base image is detected")
+	InitProjectCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Write the proposed files without asking for confirmation")
+}
+
+// detectedProject holds what init found in an existing codebase.
+type detectedProject struct {
+	HandlerPath       string
+	OtherHandlers     []string
+	RequirementsPath  string
+	PythonVersion     string
+	PythonVersionFrom string
+	Dockerfile        string
+	BaseImage         string
+	ExtraIgnores      []string
+}
+
+var (
+	serverlessStartPattern = regexp.MustCompile(`runpod\.serverless\.start\s*\(`)
+	pythonVersionPattern   = regexp.MustCompile(`(?:python-?|python:|>=\s*|~=\s*|==\s*|^)(3\.\d+)`)
+	dockerFromPattern      = regexp.MustCompile(`(?im)^\s*FROM\s+(?:--platform=\S+\s+)?(\S+)`)
+)
+
+// scanSkipDirs are never searched for handlers.
+var scanSkipDirs = []string{".git", "__pycache__", "node_modules", "venv", ".venv", "env", ".tox", ".mypy_cache", "site-packages"}
+
+// localEnvDirs are added to .runpodignore when they exist.
+var localEnvDirs = []string{"venv/", ".venv/", "env/", "node_modules/", ".env"}
+
+var requirementsCandidates = []string{
+	"builder/requirements.txt",
+	"requirements.txt",
+	"requirements/prod.txt",
+	"requirements/base.txt",
+	"src/requirements.txt",
+}
+
+// initProject writes runpod.toml and .runpodignore for the codebase in the
+// current directory. An empty name uses the directory name.
+func initProject(name, cudaVersion string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("getting current directory: %w", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(cwd, projectConfigFile)); err == nil {
+		return fmt.Errorf("%s already exists in %s", projectConfigFile, cwd)
+	}
+
+	if name == "" {
+		name = filepath.Base(cwd)
+	}
+
+	fmt.Println("Scanning", cwd)
+	detected, err := detectProject(cwd)
+	if err != nil {
+		return err
+	}
+	if detected.HandlerPath == "" {
+		return errors.New("no handler found, expected a Python file calling runpod.serverless.start")
+	}
+
+	values := projectTomlValues{
+		Name:             name,
+		BaseImage:        detected.BaseImage,
+		PythonVersion:    detected.PythonVersion,
+		HandlerPath:      detected.HandlerPath,
+		RequirementsPath: detected.RequirementsPath,
+	}
+	requirementsFound := values.RequirementsPath != ""
+	if !requirementsFound {
+		values.RequirementsPath = "requirements.txt"
+	}
+	if values.PythonVersion == "" {
+		values.PythonVersion = "3.10"
+		detected.PythonVersionFrom = "default"
+	}
+	if values.BaseImage == "" {
+		if err := validateRuntime(cudaVersion, values.PythonVersion); err != nil {
+			return err
+		}
+		values.BaseImage, _ = baseImageFor(cudaVersion)
+	}
+
+	printDetectedProject(values, detected, requirementsFound)
+
+	if !assumeYes {
+		confirm := promptui.Prompt{Label: "Write these files", IsConfirm: true}
+		if _, err := confirm.Run(); err != nil {
+			fmt.Println("Nothing was written.")
+			return nil
+		}
+	}
+
+	if err := generateProjectToml(cwd, projectConfigFile, values); err != nil {
+		return err
+	}
+	fmt.Println("Wrote", projectConfigFile)
+
+	ignorePath := filepath.Join(cwd, ".runpodignore")
+	if _, err := os.Stat(ignorePath); err == nil {
+		fmt.Println("Kept existing .runpodignore")
+	} else {
+		if err := os.WriteFile(ignorePath, []byte(runpodIgnoreContent(detected.ExtraIgnores)), 0644); err != nil {
+			return fmt.Errorf("writing .runpodignore: %w", err)
+		}
+		fmt.Println("Wrote .runpodignore")
+	}
+
+	return nil
+}
+
+func printDetectedProject(values projectTomlValues, detected *detectedProject, requirementsFound bool) {
+	fmt.Println("Proposed project settings:")
+	fmt.Printf("%sname              = %s\n", inputPromptPrefix, values.Name)
+	fmt.Printf("%shandler_path      = %s\n", inputPromptPrefix, values.HandlerPath)
+	for _, other := range detected.OtherHandlers {
+		fmt.Printf("%s                    (also found %s)\n", inputPromptPrefix, other)
+	}
+	if requirementsFound {
+		fmt.Printf("%srequirements_path = %s\n", inputPromptPrefix, values.RequirementsPath)
+	} else {
+		fmt.Printf("%srequirements_path = %s (not found, create it before running dev)\n", inputPromptPrefix, values.RequirementsPath)
+	}
+	fmt.Printf("%spython_version    = %s (%s)\n", inputPromptPrefix, values.PythonVersion, detected.PythonVersionFrom)
+	fmt.Printf("%sbase_image        = %s\n", inputPromptPrefix, values.BaseImage)
+	if detected.Dockerfile != "" {
+		fmt.Printf("%sFound %s, it is left untouched.\n", inputPromptPrefix, detected.Dockerfile)
+	}
+}
+
+// detectProject inspects the codebase in dir.
+func detectProject(dir string) (*detectedProject, error) {
+	detected := &detectedProject{}
+	root := os.DirFS(dir)
+
+	var handlers []string
+	err := fs.WalkDir(root, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != "." && contains(d.Name(), scanSkipDirs) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if path.Ext(p) != ".py" {
+			return nil
+		}
+
+		content, err := fs.ReadFile(root, p)
+		if err != nil {
+			return err
+		}
+		if serverlessStartPattern.Match(content) {
+			handlers = append(handlers, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning project: %w", err)
+	}
+
+	// Prefer code outside of tests, then files named handler.py, then the shallowest path.
+	sort.SliceStable(handlers, func(i, j int) bool {
+		iTest, jTest := isTestPath(handlers[i]), isTestPath(handlers[j])
+		if iTest != jTest {
+			return jTest
+		}
+		iHandler, jHandler := path.Base(handlers[i]) == "handler.py", path.Base(handlers[j]) == "handler.py"
+		if iHandler != jHandler {
+			return iHandler
+		}
+		return strings.Count(handlers[i], "/") < strings.Count(handlers[j], "/")
+	})
+	if len(handlers) > 0 {
+		detected.HandlerPath = handlers[0]
+		detected.OtherHandlers = handlers[1:]
+	}
+
+	for _, candidate := range requirementsCandidates {
+		if _, err := fs.Stat(root, candidate); err == nil {
+			detected.RequirementsPath = candidate
+			break
+		}
+	}
+
+	for _, candidate := range []string{"Dockerfile", "docker/Dockerfile", "builder/Dockerfile"} {
+		content, err := fs.ReadFile(root, candidate)
+		if err != nil {
+			continue
+		}
+		detected.Dockerfile = candidate
+		if match := dockerFromPattern.FindSubmatch(content); match != nil && strings.HasPrefix(string(match[1]), "runpod/") {
+			detected.BaseImage = string(match[1])
+		}
+		break
+	}
+
+	detected.PythonVersion, detected.PythonVersionFrom = detectPythonVersion(root, detected.Dockerfile)
+
+	for _, entry := range localEnvDirs {
+		if _, err := fs.Stat(root, strings.TrimSuffix(entry, "/")); err == nil {
+			detected.ExtraIgnores = append(detected.ExtraIgnores, entry)
+		}
+	}
+
+	return detected, nil
+}
+
+func isTestPath(p string) bool {
+	for _, part := range strings.Split(p, "/") {
+		if part == "tests" || part == "test" || strings.HasPrefix(part, "test_") || strings.HasSuffix(part, "_test.py") {
+			return true
+		}
+	}
+	return false
+}
+
+// detectPythonVersion looks for a Python version in the usual hint files and
+// returns it with the file it came from.
+func detectPythonVersion(root fs.FS, dockerfile string) (string, string) {
+	hints := []string{".python-version", "runtime.txt", "pyproject.toml", "setup.cfg"}
+	if dockerfile != "" {
+		hints = append(hints, dockerfile)
+	}
+
+	for _, hint := range hints {
+		content, err := fs.ReadFile(root, hint)
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if hint == "pyproject.toml" || hint == "setup.cfg" {
+				if !strings.Contains(line, "python_requires") && !strings.Contains(line, "requires-python") {
+					continue
+				}
+			}
+
+			for _, match := range pythonVersionPattern.FindAllStringSubmatch(line, -1) {
+				if contains(match[1], supportedPythonVersions()) {
+					return match[1], hint
+				}
+			}
+		}
+	}
+
+	return "", ""
+}
+
+// runpodIgnoreContent returns the .runpodignore of the embedded starter
+// templates with extra patterns appended.
+func runpodIgnoreContent(extra []string) string {
+	content, err := fs.ReadFile(starterTemplates, path.Join(basePath, "Hello_World", ".runpodignore"))
+	if err != nil {
+		content = []byte(strings.Join(EXCLUDE_PATTERNS, "\n"))
+	}
+
+	ignore := strings.TrimRight(string(content), "\n") + "\n"
+	for _, pattern := range extra {
+		ignore += pattern + "\n"
+	}
+	return ignore
+}
@@ -0,0 +1,240 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+const templateManifestFile string = "template.toml"
+
+// TemplateManifest describes a starter template. It is read from the
+// template.toml at the root of the template directory.
+type TemplateManifest struct {
+	Name         string             `toml:"-"`
+	Version      string             `toml:"version"`
+	Description  string             `toml:"description"`
+	Aliases      []string           `toml:"aliases"`
+	DefaultModel string             `toml:"default_model"`
+	GpuTypes     []string           `toml:"gpu_types"`
+	Variables    []TemplateVariable `toml:"variables"`
+	PostCreate   []PostCreateAction `toml:"post_create"`
+
+	// Source is the reference the template was loaded from, as accepted by
+	// findTemplate.
+	Source string `toml:"-"`
+
+	// files holds the template tree, rooted at the template directory.
+	files fs.FS
+}
+
+type TemplateVariable struct {
+	Name     string   `toml:"name"`
+	Prompt   string   `toml:"prompt"`
+	Default  string   `toml:"default"`
+	Pattern  string   `toml:"pattern"`
+	Choices  []string `toml:"choices"`
+	Required bool     `toml:"required"`
+}
+
+type PostCreateAction struct {
+	Action string `toml:"action"`
+	From   string `toml:"from"`
+	To     string `toml:"to"`
+	Path   string `toml:"path"`
+}
+
+// builtinTemplateVariables are always available to template files and may
+// not be redeclared by a manifest.
+var builtinTemplateVariables = []string{"PROJECT_NAME", "MODEL_TYPE", "MODEL_NAME", "CUDA_VERSION", "PYTHON_VERSION", "RUNPOD"}
+
+var templateVariableNamePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// loadTemplateManifest reads the manifest of the template rooted at files.
+// Templates without a template.toml get an empty manifest.
+func loadTemplateManifest(name string, files fs.FS) (*TemplateManifest, error) {
+	manifest := &TemplateManifest{}
+
+	content, err := fs.ReadFile(files, templateManifestFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("reading %s of template %s: %w", templateManifestFile, name, err)
+	}
+	if err == nil {
+		if err := toml.Unmarshal(content, manifest); err != nil {
+			return nil, fmt.Errorf("parsing %s of template %s: %w", templateManifestFile, name, err)
+		}
+	}
+
+	manifest.Name = name
+	manifest.Source = name
+	manifest.files = files
+
+	for _, variable := range manifest.Variables {
+		if !templateVariableNamePattern.MatchString(variable.Name) {
+			return nil, fmt.Errorf("template %s: invalid variable name %q", name, variable.Name)
+		}
+		if contains(variable.Name, builtinTemplateVariables) {
+			return nil, fmt.Errorf("template %s: variable %s is reserved", name, variable.Name)
+		}
+		if variable.Pattern != "" {
+			if _, err := regexp.Compile(variable.Pattern); err != nil {
+				return nil, fmt.Errorf("template %s: variable %s: invalid pattern: %w", name, variable.Name, err)
+			}
+		}
+		if variable.Default != "" {
+			if err := variable.Validate(variable.Default); err != nil {
+				return nil, fmt.Errorf("template %s: default value: %w", name, err)
+			}
+		}
+	}
+
+	for _, action := range manifest.PostCreate {
+		switch action.Action {
+		case "rename":
+			if action.From == "" || action.To == "" {
+				return nil, fmt.Errorf("template %s: rename action needs from and to", name)
+			}
+		case "remove":
+			if action.Path == "" {
+				return nil, fmt.Errorf("template %s: remove action needs path", name)
+			}
+		default:
+			return nil, fmt.Errorf("template %s: unknown post_create action %q", name, action.Action)
+		}
+	}
+
+	return manifest, nil
+}
+
+// listStarterTemplates returns the manifests of the embedded starter templates.
+func listStarterTemplates() ([]*TemplateManifest, error) {
+	entries, err := starterTemplates.ReadDir(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := []*TemplateManifest{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		files, err := fs.Sub(starterTemplates, path.Join(basePath, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		manifest, err := loadTemplateManifest(entry.Name(), files)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].Name < manifests[j].Name })
+	return manifests, nil
+}
+
+// Validate checks value against the variable's rules.
+func (v TemplateVariable) Validate(value string) error {
+	if value == "" {
+		if v.Required {
+			return fmt.Errorf("%s is required", v.Name)
+		}
+		return nil
+	}
+	if len(v.Choices) > 0 && !contains(value, v.Choices) {
+		return fmt.Errorf("%s must be one of %s, got %q", v.Name, strings.Join(v.Choices, ", "), value)
+	}
+	if v.Pattern != "" && !regexp.MustCompile(v.Pattern).MatchString(value) {
+		return fmt.Errorf("%s must match %s, got %q", v.Name, v.Pattern, value)
+	}
+	return nil
+}
+
+// resolveVariables applies defaults to the template's variables, overrides
+// them with values, and validates the result.
+func (m *TemplateManifest) resolveVariables(values map[string]string) (map[string]string, error) {
+	resolved := map[string]string{}
+	for _, variable := range m.Variables {
+		value, ok := values[variable.Name]
+		if !ok {
+			value = variable.Default
+		}
+		if err := variable.Validate(value); err != nil {
+			return nil, err
+		}
+		resolved[variable.Name] = value
+	}
+
+	for name := range values {
+		if _, ok := resolved[name]; !ok {
+			return nil, fmt.Errorf("template %s has no variable %s", m.Name, name)
+		}
+	}
+
+	return resolved, nil
+}
+
+// parseTemplateVariables parses NAME=VALUE pairs given with --var.
+func parseTemplateVariables(pairs []string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, pair := range pairs {
+		name, value, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid --var %q, expected NAME=VALUE", pair)
+		}
+		values[strings.TrimSpace(name)] = value
+	}
+	return values, nil
+}
+
+// applyPostCreateActions runs the manifest's post-create actions in projectDir.
+// Paths may contain placeholders.
+func (m *TemplateManifest) applyPostCreateActions(projectDir string, vars templateVars) error {
+	resolvePath := func(p string) (string, error) {
+		rendered := renderTemplate([]byte(p), vars)
+		cleaned := filepath.Clean(filepath.FromSlash(string(rendered)))
+		if filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("post_create path %q leaves the project directory", p)
+		}
+		return filepath.Join(projectDir, cleaned), nil
+	}
+
+	for _, action := range m.PostCreate {
+		switch action.Action {
+		case "rename":
+			from, err := resolvePath(action.From)
+			if err != nil {
+				return err
+			}
+			to, err := resolvePath(action.To)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+				return err
+			}
+			if err := os.Rename(from, to); err != nil {
+				return fmt.Errorf("renaming %s: %w", action.From, err)
+			}
+		case "remove":
+			target, err := resolvePath(action.Path)
+			if err != nil {
+				return err
+			}
+			if err := os.RemoveAll(target); err != nil {
+				return fmt.Errorf("removing %s: %w", action.Path, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,224 @@
+package project
+
+import (
+	"fmt"
+	"strings"
+)
+
+// splitLines splits text into lines, keeping line endings so that merged
+// output reproduces the input byte for byte.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// matchLines returns, for every line of a, the index of the matching line of
+// b in a longest common subsequence, or -1 when the line has no match.
+func matchLines(a, b []string) []int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	matches := make([]int, len(a))
+	i, j := 0, 0
+	for i < len(a) {
+		switch {
+		case j < len(b) && a[i] == b[j]:
+			matches[i] = j
+			i++
+			j++
+		case j < len(b) && lcs[i][j+1] >= lcs[i+1][j]:
+			j++
+		default:
+			matches[i] = -1
+			i++
+		}
+	}
+	return matches
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeResult is the outcome of a three-way merge.
+type mergeResult struct {
+	Text      string
+	Conflicts int
+}
+
+// mergeThreeWay merges the changes from base to theirs into ours. Regions
+// changed differently on both sides are written with conflict markers.
+func mergeThreeWay(base, ours, theirs, oursLabel, theirsLabel string) mergeResult {
+	baseLines, oursLines, theirsLines := splitLines(base), splitLines(ours), splitLines(theirs)
+	oursMatches := matchLines(baseLines, oursLines)
+	theirsMatches := matchLines(baseLines, theirsLines)
+
+	var out strings.Builder
+	conflicts := 0
+	i, a, b := 0, 0, 0
+
+	for {
+		// Find the next base line kept by both sides.
+		j := i
+		for j < len(baseLines) && (oursMatches[j] < 0 || theirsMatches[j] < 0) {
+			j++
+		}
+
+		oursEnd, theirsEnd := len(oursLines), len(theirsLines)
+		if j < len(baseLines) {
+			oursEnd, theirsEnd = oursMatches[j], theirsMatches[j]
+		}
+
+		baseChunk, oursChunk, theirsChunk := baseLines[i:j], oursLines[a:oursEnd], theirsLines[b:theirsEnd]
+		switch {
+		case equalLines(oursChunk, baseChunk):
+			out.WriteString(strings.Join(theirsChunk, ""))
+		case equalLines(theirsChunk, baseChunk), equalLines(oursChunk, theirsChunk):
+			out.WriteString(strings.Join(oursChunk, ""))
+		default:
+			conflicts++
+			writeConflict(&out, oursChunk, baseChunk, theirsChunk, oursLabel, theirsLabel)
+		}
+
+		if j == len(baseLines) {
+			break
+		}
+
+		out.WriteString(baseLines[j])
+		i, a, b = j+1, oursEnd+1, theirsEnd+1
+	}
+
+	return mergeResult{Text: out.String(), Conflicts: conflicts}
+}
+
+func writeConflict(out *strings.Builder, ours, base, theirs []string, oursLabel, theirsLabel string) {
+	writeSection := func(lines []string) {
+		for _, line := range lines {
+			out.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				out.WriteString("\n")
+			}
+		}
+	}
+
+	out.WriteString("<<<<<<< " + oursLabel + "\n")
+	writeSection(ours)
+	out.WriteString("||||||| original template\n")
+	writeSection(base)
+	out.WriteString("=======\n")
+	writeSection(theirs)
+	out.WriteString(">>>>>>> " + theirsLabel + "\n")
+}
+
+// unifiedDiff returns a unified diff between two texts with three lines of
+// context, or an empty string when they are equal.
+func unifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+
+	oldLines, newLines := splitLines(oldText), splitLines(newText)
+	matches := matchLines(oldLines, newLines)
+
+	// Build the edit script as a list of operations.
+	type op struct {
+		kind byte
+		line string
+		oldN int
+		newN int
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && matches[i] == -1:
+			ops = append(ops, op{'-', oldLines[i], i, j})
+			i++
+		case i < len(oldLines) && matches[i] == j:
+			ops = append(ops, op{' ', oldLines[i], i, j})
+			i++
+			j++
+		default:
+			ops = append(ops, op{'+', newLines[j], i, j})
+			j++
+		}
+	}
+
+	const context = 3
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+
+		// Extend the hunk while changes are within 2*context lines of each other.
+		hunkStart := max(0, start-context)
+		end := start
+		for k := start; k < len(ops); k++ {
+			if ops[k].kind != ' ' {
+				end = k
+			} else if k-end > 2*context {
+				break
+			}
+		}
+		hunkEnd := min(len(ops), end+context+1)
+
+		oldCount, newCount := 0, 0
+		for _, o := range ops[hunkStart:hunkEnd] {
+			if o.kind != '+' {
+				oldCount++
+			}
+			if o.kind != '-' {
+				newCount++
+			}
+		}
+		// An empty range starts at the line before it, as in diff -u.
+		oldStart, newStart := ops[hunkStart].oldN+1, ops[hunkStart].newN+1
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, o := range ops[hunkStart:hunkEnd] {
+			out.WriteByte(o.kind)
+			out.WriteString(o.line)
+			if !strings.HasSuffix(o.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		start = hunkEnd
+	}
+
+	return out.String()
+}
@@ -0,0 +1,165 @@
+package project
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []int
+	}{
+		{"equal", []string{"a\n", "b\n"}, []string{"a\n", "b\n"}, []int{0, 1}},
+		{"deleted line", []string{"x\n", "y\n", "z\n"}, []string{"x\n", "z\n"}, []int{0, -1, 1}},
+		{"empty b", []string{"x\n", "y\n"}, nil, []int{-1, -1}},
+		{"empty a", nil, []string{"x\n"}, []int{}},
+		{"longest subsequence", []string{"a\n", "b\n", "a\n"}, []string{"b\n", "a\n"}, []int{-1, 0, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := matchLines(test.a, test.b); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("matchLines(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMergeThreeWay(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		wantConflicts      int
+	}{
+		{
+			name:   "unchanged",
+			base:   "a\nb\n",
+			ours:   "a\nb\n",
+			theirs: "a\nb\n",
+			want:   "a\nb\n",
+		},
+		{
+			name:   "clean merge",
+			base:   "a\nb\nc\nd\ne\n",
+			ours:   "A\nb\nc\nd\ne\n",
+			theirs: "a\nb\nc\nd\nE\n",
+			want:   "A\nb\nc\nd\nE\n",
+		},
+		{
+			name:          "overlapping changes",
+			base:          "a\nb\nc\n",
+			ours:          "a\nX\nc\n",
+			theirs:        "a\nY\nc\n",
+			want:          "a\n<<<<<<< local\nX\n||||||| original template\nb\n=======\nY\n>>>>>>> template\nc\n",
+			wantConflicts: 1,
+		},
+		{
+			name:   "deleted locally, added in template",
+			base:   "a\nb\nc\n",
+			ours:   "a\nc\n",
+			theirs: "a\nb\nc\nd\n",
+			want:   "a\nc\nd\n",
+		},
+		{
+			name:   "deleted in template",
+			base:   "a\nb\nc\n",
+			ours:   "a\nb\nc\nd\n",
+			theirs: "a\nc\n",
+			want:   "a\nc\nd\n",
+		},
+		{
+			name:          "deleted locally, changed in template",
+			base:          "a\nb\nc\n",
+			ours:          "a\nc\n",
+			theirs:        "a\nB\nc\n",
+			want:          "a\n<<<<<<< local\n||||||| original template\nb\n=======\nB\n>>>>>>> template\nc\n",
+			wantConflicts: 1,
+		},
+		{
+			name:   "missing trailing newline",
+			base:   "a\nb\nc",
+			ours:   "A\nb\nc",
+			theirs: "a\nb\nC",
+			want:   "A\nb\nC",
+		},
+		{
+			name:          "conflict without trailing newline",
+			base:          "a\nb",
+			ours:          "a\nx",
+			theirs:        "a\ny",
+			want:          "a\n<<<<<<< local\nx\n||||||| original template\nb\n=======\ny\n>>>>>>> template\n",
+			wantConflicts: 1,
+		},
+		{
+			name:   "identical changes",
+			base:   "a\nb\nc\n",
+			ours:   "a\nB\nc\nd\n",
+			theirs: "a\nB\nc\nd\n",
+			want:   "a\nB\nc\nd\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := mergeThreeWay(test.base, test.ours, test.theirs, "local", "template")
+			if got.Text != test.want {
+				t.Errorf("merged text =\n%q\nwant\n%q", got.Text, test.want)
+			}
+			if got.Conflicts != test.wantConflicts {
+				t.Errorf("conflicts = %d, want %d", got.Conflicts, test.wantConflicts)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name             string
+		oldText, newText string
+		want             string
+	}{
+		{
+			name:    "equal",
+			oldText: "a\nb\n",
+			newText: "a\nb\n",
+			want:    "",
+		},
+		{
+			name:    "changed line",
+			oldText: "a\nb\nc\n",
+			newText: "a\nB\nc\n",
+			want:    "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name:    "new file",
+			oldText: "",
+			newText: "a\n",
+			want:    "--- old\n+++ new\n@@ -0,0 +1,1 @@\n+a\n",
+		},
+		{
+			name:    "missing trailing newline",
+			oldText: "a\nb",
+			newText: "a\nc",
+			want:    "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+		{
+			name:    "separate hunks",
+			oldText: "l1\nl2\nl3\nl4\nl5\nl6\nl7\nl8\nl9\nl10\n",
+			newText: "L1\nl2\nl3\nl4\nl5\nl6\nl7\nl8\nl9\nL10\n",
+			want: "--- old\n+++ new\n" +
+				"@@ -1,4 +1,4 @@\n-l1\n+L1\n l2\n l3\n l4\n" +
+				"@@ -7,4 +7,4 @@\n l7\n l8\n l9\n-l10\n+L10\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := unifiedDiff("old", "new", test.oldText, test.newText); got != test.want {
+				t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package project
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ociLayoutFile      = "oci-layout"
+	ociIndexFile       = "index.json"
+	ociRefNameKey      = "org.opencontainers.image.ref.name"
+	mediaTypeOCIIndex  = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIImage  = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIConfig = "application/vnd.oci.image.config.v1+json"
+	mediaTypeOCILayer  = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	mediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerLayer    = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+type ociPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *ociPlatform      `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndex struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Manifests     []ociDescriptor   `json:"manifests"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Config        ociDescriptor     `json:"config"`
+	Layers        []ociDescriptor   `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// ociLayout is an OCI image layout directory: an oci-layout marker, an
+// index.json and content addressed blobs under blobs/<algorithm>/.
+type ociLayout struct {
+	dir string
+}
+
+func openOCILayout(dir string) (*ociLayout, error) {
+	content, err := os.ReadFile(filepath.Join(dir, ociLayoutFile))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not an OCI image layout: %w", dir, err)
+	}
+	var marker struct {
+		Version string `json:"imageLayoutVersion"`
+	}
+	if err := json.Unmarshal(content, &marker); err != nil || marker.Version == "" {
+		return nil, fmt.Errorf("%s has an invalid %s file", dir, ociLayoutFile)
+	}
+	return &ociLayout{dir: dir}, nil
+}
+
+// createOCILayout opens the layout in dir, creating an empty one if needed.
+func createOCILayout(dir string) (*ociLayout, error) {
+	if _, err := os.Stat(filepath.Join(dir, ociLayoutFile)); err == nil {
+		return openOCILayout(dir)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ociLayoutFile), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644); err != nil {
+		return nil, err
+	}
+	layout := &ociLayout{dir: dir}
+	if err := layout.writeIndex(&ociIndex{SchemaVersion: 2, MediaType: mediaTypeOCIIndex, Manifests: []ociDescriptor{}}); err != nil {
+		return nil, err
+	}
+	return layout, nil
+}
+
+// blobPath returns the path of the blob with digest, which must have the
+// form algorithm:hex.
+func (l *ociLayout) blobPath(digest string) (string, error) {
+	algorithm, encoded, found := strings.Cut(digest, ":")
+	if !found || algorithm != "sha256" || len(encoded) != 64 || strings.Trim(encoded, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+	return filepath.Join(l.dir, "blobs", algorithm, encoded), nil
+}
+
+func (l *ociLayout) hasBlob(digest string) bool {
+	p, err := l.blobPath(digest)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(p)
+	return err == nil
+}
+
+// readBlob reads a blob and verifies its digest.
+func (l *ociLayout) readBlob(digest string) ([]byte, error) {
+	p, err := l.blobPath(digest)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("reading blob %s: %w", digest, err)
+	}
+	if sha256Digest(content) != digest {
+		return nil, fmt.Errorf("blob %s is corrupt", digest)
+	}
+	return content, nil
+}
+
+// writeBlob stores content and returns its digest.
+func (l *ociLayout) writeBlob(content []byte) (string, error) {
+	digest := sha256Digest(content)
+	p, err := l.blobPath(digest)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(p); err == nil {
+		return digest, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(p, content, 0644); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// importBlob moves the file at src into the layout as the blob with digest.
+func (l *ociLayout) importBlob(src, digest string) error {
+	p, err := l.blobPath(digest)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return os.Rename(src, p)
+}
+
+// copyBlob copies a blob from another layout, hard linking when possible.
+func (l *ociLayout) copyBlob(from *ociLayout, digest string) error {
+	if l.hasBlob(digest) {
+		return nil
+	}
+	src, err := from.blobPath(digest)
+	if err != nil {
+		return err
+	}
+	dst, err := l.blobPath(digest)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	// Copy into a temporary file, so a failed copy never leaves a partial
+	// blob that hasBlob would take for a complete one.
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("reading blob %s: %w", digest, err)
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Join(l.dir, "blobs"), ".blob-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), in); err != nil {
+		return fmt.Errorf("copying blob %s: %w", digest, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if "sha256:"+hex.EncodeToString(hash.Sum(nil)) != digest {
+		return fmt.Errorf("blob %s is corrupt", digest)
+	}
+	return l.importBlob(tmp.Name(), digest)
+}
+
+func (l *ociLayout) readIndex() (*ociIndex, error) {
+	content, err := os.ReadFile(filepath.Join(l.dir, ociIndexFile))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", ociIndexFile, err)
+	}
+	index := &ociIndex{}
+	if err := json.Unmarshal(content, index); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", ociIndexFile, err)
+	}
+	return index, nil
+}
+
+func (l *ociLayout) writeIndex(index *ociIndex) error {
+	content, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(l.dir, ociIndexFile), content, 0644)
+}
+
+// tagManifest adds desc to index.json under ref, replacing an earlier
+// manifest with the same ref.
+func (l *ociLayout) tagManifest(desc ociDescriptor, ref string) error {
+	index, err := l.readIndex()
+	if err != nil {
+		return err
+	}
+
+	desc.Annotations = map[string]string{ociRefNameKey: ref}
+	manifests := []ociDescriptor{}
+	for _, existing := range index.Manifests {
+		if existing.Annotations[ociRefNameKey] != ref {
+			manifests = append(manifests, existing)
+		}
+	}
+	index.Manifests = append(manifests, desc)
+	return l.writeIndex(index)
+}
+
+// resolveImage finds the image manifest for ref and platform. An empty ref
+// selects the only image of the layout. Image indexes are followed to the
+// manifest of the requested platform.
+func (l *ociLayout) resolveImage(ref string, platform ociPlatform) (ociDescriptor, *ociManifest, error) {
+	index, err := l.readIndex()
+	if err != nil {
+		return ociDescriptor{}, nil, err
+	}
+
+	candidates := []ociDescriptor{}
+	for _, desc := range index.Manifests {
+		if ref == "" || desc.Annotations[ociRefNameKey] == ref {
+			candidates = append(candidates, desc)
+		}
+	}
+	switch {
+	case len(candidates) == 0 && ref != "":
+		return ociDescriptor{}, nil, fmt.Errorf("no image tagged %q in %s", ref, l.dir)
+	case len(candidates) == 0:
+		return ociDescriptor{}, nil, fmt.Errorf("%s contains no images", l.dir)
+	case len(candidates) > 1 && ref == "":
+		// Several entries may be the platforms of one untagged image.
+		if desc, ok := matchPlatform(candidates, platform); ok {
+			candidates = []ociDescriptor{desc}
+		} else {
+			return ociDescriptor{}, nil, fmt.Errorf("%s contains several images, choose one with a ref", l.dir)
+		}
+	}
+
+	desc := candidates[0]
+	for depth := 0; depth < 4; depth++ {
+		content, err := l.readBlob(desc.Digest)
+		if err != nil {
+			return ociDescriptor{}, nil, err
+		}
+
+		switch desc.MediaType {
+		case mediaTypeOCIIndex, mediaTypeDockerList:
+			nested := &ociIndex{}
+			if err := json.Unmarshal(content, nested); err != nil {
+				return ociDescriptor{}, nil, fmt.Errorf("parsing image index %s: %w", desc.Digest, err)
+			}
+			match, ok := matchPlatform(nested.Manifests, platform)
+			if !ok {
+				return ociDescriptor{}, nil, fmt.Errorf("image has no %s/%s variant", platform.OS, platform.Architecture)
+			}
+			desc = match
+		case mediaTypeOCIImage, mediaTypeDockerManifest:
+			manifest := &ociManifest{}
+			if err := json.Unmarshal(content, manifest); err != nil {
+				return ociDescriptor{}, nil, fmt.Errorf("parsing image manifest %s: %w", desc.Digest, err)
+			}
+			return desc, manifest, nil
+		default:
+			return ociDescriptor{}, nil, fmt.Errorf("unsupported media type %s", desc.MediaType)
+		}
+	}
+	return ociDescriptor{}, nil, errors.New("image indexes are nested too deeply")
+}
+
+func matchPlatform(descs []ociDescriptor, platform ociPlatform) (ociDescriptor, bool) {
+	for _, desc := range descs {
+		if desc.Platform == nil {
+			continue
+		}
+		if desc.Platform.OS == platform.OS && desc.Platform.Architecture == platform.Architecture &&
+			(platform.Variant == "" || desc.Platform.Variant == platform.Variant) {
+			return desc, true
+		}
+	}
+	return ociDescriptor{}, false
+}
+
+// parsePlatform parses os/architecture[/variant].
+func parsePlatform(value string) (ociPlatform, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return ociPlatform{}, fmt.Errorf("invalid platform %q, expected os/architecture", value)
+	}
+	platform := ociPlatform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+	return platform, nil
+}
+
+func sha256Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
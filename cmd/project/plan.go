@@ -0,0 +1,219 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yourusername/airfoil/api"
+)
+
+// errChangesPending is returned by deploy --plan when the endpoint differs
+// from runpod.toml.
+var errChangesPending = errors.New("changes pending")
+
+// planChange is one difference between the deployed and the desired state.
+// An empty Current means the value is added, an empty Desired that it is
+// removed.
+type planChange struct {
+	Field   string
+	Current string
+	Desired string
+}
+
+func (c planChange) String() string {
+	switch {
+	case c.Current == "":
+		return fmt.Sprintf("+ %s: %s", c.Field, c.Desired)
+	case c.Desired == "":
+		return fmt.Sprintf("- %s: %s", c.Field, c.Current)
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Field, c.Current, c.Desired)
+	}
+}
+
+// deployPlan compares the endpoint and template of the environment with
+// what runpod.toml would produce.
+type deployPlan struct {
+	// Endpoint and Template are the deployed resources, nil when missing.
+	Endpoint *api.Endpoint
+	Template *api.Template
+
+	Image   string
+	EnvVars []EnvVar
+	Input   *api.CreateEndpointInput
+	// Revision is the git checkout the image was built from, empty when the
+	// image was not built by airfoil.
+	Revision gitRevision
+
+	EndpointChanges []planChange
+	TemplateChanges []planChange
+}
+
+func (p *deployPlan) pending() bool {
+	return len(p.EndpointChanges) > 0 || len(p.TemplateChanges) > 0
+}
+
+// planDeploy fetches the endpoint and template of the environment and
+// compares them with runpod.toml and the image to deploy.
+func planDeploy(config *ProjectConfig, state *ProjectState) (*deployPlan, error) {
+	if err := validateEndpointSettings(config); err != nil {
+		return nil, err
+	}
+	image, err := deployImage(state)
+	if err != nil {
+		return nil, err
+	}
+	envVars, err := resolveProjectEnv(config)
+	if err != nil {
+		return nil, err
+	}
+	input, err := projectEndpointInput(config, "")
+	if err != nil {
+		return nil, err
+	}
+	endpoint, err := findProjectEndpoint(config, state)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &deployPlan{
+		Endpoint: endpoint,
+		Image:    image,
+		EnvVars:  envVars,
+		Input:    input,
+		Revision: imageRevision(state, image),
+	}
+
+	if endpoint != nil {
+		templates, err := api.GetTemplates()
+		if err != nil {
+			return nil, fmt.Errorf("getting templates: %w", err)
+		}
+		for _, template := range templates {
+			if template.Id == endpoint.TemplateId {
+				plan.Template = template
+			}
+		}
+	}
+
+	plan.EndpointChanges = diffEndpoint(endpoint, plan.Input)
+	plan.TemplateChanges = diffTemplate(plan.Template, config, image, envVars)
+	return plan, nil
+}
+
+func diffEndpoint(current *api.Endpoint, desired *api.CreateEndpointInput) []planChange {
+	if current == nil {
+		current = &api.Endpoint{}
+	}
+	fields := []struct {
+		name             string
+		current, desired string
+	}{
+		{"gpu_types", current.GpuIds, desired.GpuIds},
+		{"active_workers", strconv.Itoa(current.WorkersMin), strconv.Itoa(desired.WorkersMin)},
+		{"max_workers", strconv.Itoa(current.WorkersMax), strconv.Itoa(desired.WorkersMax)},
+		{"idle_timeout", strconv.Itoa(current.IdleTimeout), strconv.Itoa(desired.IdleTimeout)},
+		{"flashboot", strconv.FormatBool(strings.HasSuffix(current.Name, "-fb")), strconv.FormatBool(strings.HasSuffix(desired.Name, "-fb"))},
+		{"locations", current.Locations, desired.Locations},
+		{"network_volume_id", current.NetworkVolumeId, desired.NetworkVolumeId},
+	}
+
+	changes := []planChange{}
+	for _, field := range fields {
+		if current.Id == "" {
+			if field.desired != "" && field.desired != "false" {
+				changes = append(changes, planChange{Field: field.name, Desired: field.desired})
+			}
+			continue
+		}
+		if field.current != field.desired {
+			changes = append(changes, planChange{Field: field.name, Current: orNone(field.current), Desired: orNone(field.desired)})
+		}
+	}
+	return changes
+}
+
+func diffTemplate(current *api.Template, config *ProjectConfig, image string, envVars []EnvVar) []planChange {
+	if current == nil {
+		current = &api.Template{}
+	}
+	changes := []planChange{}
+	if current.ImageName != image {
+		changes = append(changes, planChange{Field: "image", Current: current.ImageName, Desired: image})
+	}
+	if current.Id != "" && current.ContainerDiskInGb != config.Project.ContainerDiskSizeGb {
+		changes = append(changes, planChange{Field: "container_disk_size_gb", Current: strconv.Itoa(current.ContainerDiskInGb), Desired: strconv.Itoa(config.Project.ContainerDiskSizeGb)})
+	}
+	if current.Id != "" && current.VolumeMountPath != config.Project.VolumeMountPath {
+		changes = append(changes, planChange{Field: "volume_mount_path", Current: orNone(current.VolumeMountPath), Desired: orNone(config.Project.VolumeMountPath)})
+	}
+
+	deployed := map[string]string{}
+	for _, env := range current.Env {
+		deployed[env.Key] = env.Value
+	}
+	for _, envVar := range envVars {
+		value, ok := deployed[envVar.Key]
+		delete(deployed, envVar.Key)
+		field := "env " + envVar.Key
+		switch {
+		case !ok:
+			changes = append(changes, planChange{Field: field, Desired: envVar.Display()})
+		case value != envVar.Value:
+			// Values from the local machine are masked on both sides.
+			currentValue := value
+			if envVar.source == envLocal {
+				currentValue = "********"
+			}
+			changes = append(changes, planChange{Field: field, Current: orNone(currentValue), Desired: orNone(envVar.Display())})
+		}
+	}
+	removed := make([]string, 0, len(deployed))
+	for key := range deployed {
+		removed = append(removed, key)
+	}
+	sort.Strings(removed)
+	for _, key := range removed {
+		changes = append(changes, planChange{Field: "env " + key, Current: "(set)"})
+	}
+	return changes
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "(none)"
+	}
+	return value
+}
+
+// print writes the plan in a readable form.
+func (p *deployPlan) print() {
+	if p.Endpoint == nil {
+		fmt.Printf("Endpoint %s will be created:\n", p.Input.Name)
+	} else if len(p.EndpointChanges) > 0 {
+		fmt.Printf("Endpoint %s (%s) will be updated:\n", p.Endpoint.Id, p.Endpoint.Name)
+	}
+	for _, change := range p.EndpointChanges {
+		fmt.Printf("%s%s\n", inputPromptPrefix, change)
+	}
+
+	switch {
+	case len(p.TemplateChanges) == 0:
+	case p.Template == nil && p.Endpoint != nil:
+		fmt.Printf("Template %s is not accessible and will be replaced:\n", p.Endpoint.TemplateId)
+	case p.Template == nil:
+		fmt.Println("A template will be created:")
+	default:
+		fmt.Printf("Template %s (%s) will be replaced:\n", p.Template.Id, p.Template.Name)
+	}
+	for _, change := range p.TemplateChanges {
+		fmt.Printf("%s%s\n", inputPromptPrefix, change)
+	}
+
+	if !p.pending() {
+		fmt.Printf("No changes, endpoint %s is up to date\n", p.Endpoint.Id)
+	}
+}
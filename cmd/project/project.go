@@ -10,4 +10,6 @@ var (
 	initCurrentDir          bool
 	setDefaultNetworkVolume bool
 	showPrefixInPodLogs     bool
+	templateVariables       []string
+	templateSource          string
 )
@@ -0,0 +1,600 @@
+package project
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dockerHubRegistry = "registry-1.docker.io"
+	dockerHubAuthKey  = "https://index.docker.io/v1/"
+
+	// identityTokenUsername is the username docker stores with an identity
+	// token, a refresh token that is exchanged at the token realm.
+	identityTokenUsername = "<token>"
+)
+
+// imageReference is a parsed registry/repository[:tag][@digest] reference.
+type imageReference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+var referencePattern = regexp.MustCompile(`^(?:([a-zA-Z0-9.-]+(?::[0-9]+)?|localhost)/)?([a-z0-9]+(?:[._-][a-z0-9]+)*(?:/[a-z0-9]+(?:[._-][a-z0-9]+)*)*)(?::([\w][\w.-]{0,127}))?(?:@(sha256:[a-f0-9]{64}))?$`)
+
+// parseImageReference parses an image reference the way docker does: a first
+// component without a dot, colon or "localhost" is part of a Docker Hub
+// repository.
+func parseImageReference(value string) (imageReference, error) {
+	match := referencePattern.FindStringSubmatch(value)
+	if match == nil {
+		return imageReference{}, fmt.Errorf("invalid image reference %q", value)
+	}
+
+	ref := imageReference{Registry: match[1], Repository: match[2], Tag: match[3], Digest: match[4]}
+	if ref.Registry != "" && !strings.ContainsAny(ref.Registry, ".:") && ref.Registry != "localhost" {
+		ref.Repository = ref.Registry + "/" + ref.Repository
+		ref.Registry = ""
+	}
+	if ref.Registry == "" || ref.Registry == "docker.io" || ref.Registry == "index.docker.io" {
+		ref.Registry = dockerHubRegistry
+		if !strings.Contains(ref.Repository, "/") {
+			ref.Repository = "library/" + ref.Repository
+		}
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	return ref, nil
+}
+
+func (r imageReference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// registryClient talks to a registry over the Distribution v2 API.
+type registryClient struct {
+	ref           imageReference
+	baseURL       string
+	client        *http.Client
+	username      string
+	password      string
+	identityToken string
+	token         string
+	chunkSize     int64
+}
+
+func newRegistryClient(ref imageReference, plainHTTP bool, chunkSize int64) (*registryClient, error) {
+	scheme := "https"
+	host, _, _ := strings.Cut(ref.Registry, ":")
+	if plainHTTP || host == "localhost" || host == "127.0.0.1" {
+		scheme = "http"
+	}
+
+	c := &registryClient{
+		ref:       ref,
+		baseURL:   scheme + "://" + ref.Registry,
+		client:    &http.Client{Timeout: 10 * time.Minute},
+		chunkSize: chunkSize,
+	}
+
+	var err error
+	c.username, c.password, err = dockerCredentials(ref.Registry)
+	if err != nil {
+		return nil, err
+	}
+	if c.username == identityTokenUsername {
+		c.identityToken, c.username, c.password = c.password, "", ""
+	}
+	return c, nil
+}
+
+// do sends a request, authenticating and retrying once when the registry
+// answers 401. body must be replayable, so it is passed as bytes.
+func (c *registryClient) do(method, target string, headers map[string]string, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, c.resolveURL(target), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = int64(len(body))
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		switch {
+		case c.token != "":
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		case c.username != "":
+			req.SetBasicAuth(c.username, c.password)
+		}
+
+		res, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return res, nil
+		}
+
+		challenge := res.Header.Get("WWW-Authenticate")
+		res.Body.Close()
+		if err := c.authenticate(challenge); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *registryClient) resolveURL(target string) string {
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		return target
+	}
+	return c.baseURL + target
+}
+
+var challengeParamPattern = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// authenticate answers a WWW-Authenticate challenge. Basic challenges use the
+// docker credentials directly; bearer challenges exchange them, or the
+// identity token, for a token.
+func (c *registryClient) authenticate(challenge string) error {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.identityToken != "" {
+			return fmt.Errorf("%s asks for a password, but docker login stored an identity token for it", c.ref.Registry)
+		}
+		if c.username == "" {
+			return fmt.Errorf("%s requires credentials, run docker login %s", c.ref.Registry, c.ref.Registry)
+		}
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("unsupported authentication challenge %q from %s", challenge, c.ref.Registry)
+	}
+
+	values := map[string]string{}
+	for _, match := range challengeParamPattern.FindAllStringSubmatch(params, -1) {
+		values[match[1]] = match[2]
+	}
+	if values["realm"] == "" {
+		return fmt.Errorf("authentication challenge from %s has no realm", c.ref.Registry)
+	}
+
+	scope := fmt.Sprintf("repository:%s:pull,push", c.ref.Repository)
+	var req *http.Request
+	var err error
+	if c.identityToken != "" {
+		// Identity tokens are OAuth2 refresh tokens and must be exchanged
+		// with a POST, they are not accepted as basic auth passwords.
+		form := url.Values{}
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", c.identityToken)
+		form.Set("service", values["service"])
+		form.Set("scope", scope)
+		form.Set("client_id", "airfoil")
+		req, err = http.NewRequest(http.MethodPost, values["realm"], strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		query := url.Values{}
+		if values["service"] != "" {
+			query.Set("service", values["service"])
+		}
+		query.Set("scope", scope)
+		req, err = http.NewRequest(http.MethodGet, values["realm"]+"?"+query.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		if c.username != "" {
+			req.SetBasicAuth(c.username, c.password)
+		}
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("requesting registry token: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("requesting registry token: statuscode %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return fmt.Errorf("parsing registry token: %w", err)
+	}
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+	if c.token == "" {
+		return errors.New("registry returned an empty token")
+	}
+	return nil
+}
+
+func (c *registryClient) blobExists(digest string) (bool, error) {
+	res, err := c.do(http.MethodHead, fmt.Sprintf("/v2/%s/blobs/%s", c.ref.Repository, digest), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("checking blob %s: statuscode %d", digest, res.StatusCode)
+	}
+}
+
+// uploadSession is an unfinished upload and the offset up to which the
+// registry accepted its chunks.
+type uploadSession struct {
+	Location string `json:"location"`
+	Offset   int64  `json:"offset"`
+}
+
+// uploadSessions remembers unfinished uploads, keyed by repository and
+// digest, so an interrupted push resumes where it stopped.
+type uploadSessions struct {
+	path     string
+	Sessions map[string]uploadSession `json:"sessions"`
+}
+
+func loadUploadSessions(path string) *uploadSessions {
+	sessions := &uploadSessions{path: path}
+	if content, err := os.ReadFile(path); err == nil {
+		if json.Unmarshal(content, sessions) != nil {
+			sessions.Sessions = nil
+		}
+	}
+	if sessions.Sessions == nil {
+		sessions.Sessions = map[string]uploadSession{}
+	}
+	return sessions
+}
+
+// set records the session of key, or forgets it when location is empty.
+func (s *uploadSessions) set(key, location string, offset int64) error {
+	if location == "" {
+		delete(s.Sessions, key)
+	} else {
+		s.Sessions[key] = uploadSession{Location: location, Offset: offset}
+	}
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("saving upload progress: %w", err)
+	}
+	if err := os.WriteFile(s.path, content, 0644); err != nil {
+		return fmt.Errorf("saving upload progress: %w", err)
+	}
+	return nil
+}
+
+// errUploadRange is returned for a chunk the registry rejects because it
+// does not continue the data it received.
+var errUploadRange = errors.New("registry rejected the chunk offset")
+
+// uploadBlob uploads the blob at path in chunks. An upload session left by an
+// earlier attempt is resumed from its recorded offset when the registry
+// agrees with it, and is started over otherwise.
+func (c *registryClient) uploadBlob(path, digest string, sessions *uploadSessions) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	// The upload still works when its progress cannot be saved, it just
+	// cannot be resumed, so that is reported once and not treated as fatal.
+	sessionKey := c.ref.Registry + "/" + c.ref.Repository + "@" + digest
+	warned := false
+	saveSession := func(location string, offset int64) {
+		if err := sessions.set(sessionKey, location, offset); err != nil && !warned {
+			warned = true
+			fmt.Printf("%s%s, an interrupted push will start this blob over\n", inputPromptPrefix, err)
+		}
+	}
+	location, offset := "", int64(0)
+	if previous, ok := sessions.Sessions[sessionKey]; ok {
+		if received, ok := c.uploadStatus(previous.Location); ok && received == previous.Offset {
+			location, offset = previous.Location, previous.Offset
+			fmt.Printf("%sResuming %s at %s\n", inputPromptPrefix, shortDigest(digest), formatBytes(offset))
+		} else {
+			saveSession("", 0)
+		}
+	}
+	if location == "" {
+		if location, err = c.startUpload(); err != nil {
+			return err
+		}
+		saveSession(location, 0)
+	}
+
+	buffer := make([]byte, c.chunkSize)
+	retries, restarted := 0, false
+	for offset < size {
+		n, err := file.ReadAt(buffer[:min(c.chunkSize, size-offset)], offset)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		next, err := c.uploadChunk(location, buffer[:n], offset)
+		if errors.Is(err, errUploadRange) && !restarted {
+			// The session does not hold what it was thought to, start over.
+			fmt.Printf("%sRestarting upload of %s\n", inputPromptPrefix, shortDigest(digest))
+			restarted = true
+			saveSession("", 0)
+			if location, err = c.startUpload(); err != nil {
+				return err
+			}
+			offset = 0
+			saveSession(location, 0)
+			continue
+		}
+		if err != nil {
+			// Ask the registry how much it received and continue from there.
+			resumed, ok := c.uploadStatus(location)
+			if !ok || retries >= 3 {
+				return fmt.Errorf("uploading %s: %w", shortDigest(digest), err)
+			}
+			retries++
+			offset = resumed
+			continue
+		}
+		location = next
+		offset += int64(n)
+		saveSession(location, offset)
+	}
+
+	if err := c.finishUpload(location, digest); err != nil {
+		return err
+	}
+	saveSession("", 0)
+	return nil
+}
+
+func (c *registryClient) startUpload() (string, error) {
+	res, err := c.do(http.MethodPost, fmt.Sprintf("/v2/%s/blobs/uploads/", c.ref.Repository), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusAccepted {
+		return "", registryError("starting upload", res)
+	}
+	return c.location(res)
+}
+
+func (c *registryClient) uploadChunk(location string, chunk []byte, offset int64) (string, error) {
+	headers := map[string]string{
+		"Content-Type":  "application/octet-stream",
+		"Content-Range": fmt.Sprintf("%d-%d", offset, offset+int64(len(chunk))-1),
+	}
+	res, err := c.do(http.MethodPatch, location, headers, chunk)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return "", fmt.Errorf("uploading chunk at %d: %w", offset, errUploadRange)
+	}
+	if res.StatusCode != http.StatusAccepted {
+		return "", registryError("uploading chunk", res)
+	}
+	return c.location(res)
+}
+
+// uploadStatus returns the offset to continue an upload session from.
+func (c *registryClient) uploadStatus(location string) (int64, bool) {
+	res, err := c.do(http.MethodGet, location, nil, nil)
+	if err != nil {
+		return 0, false
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		return 0, false
+	}
+
+	// Range is "0-<last byte received>", inclusive. Registries send 0-0 for
+	// a session without data as well as for one holding a single byte, so it
+	// is taken as empty; a wrong guess is rejected with 416 on the next chunk.
+	rangeHeader := res.Header.Get("Range")
+	if rangeHeader == "" || rangeHeader == "0-0" {
+		return 0, true
+	}
+	_, end, found := strings.Cut(rangeHeader, "-")
+	last, err := strconv.ParseInt(end, 10, 64)
+	if !found || err != nil {
+		return 0, false
+	}
+	return last + 1, true
+}
+
+func (c *registryClient) finishUpload(location, digest string) error {
+	separator := "?"
+	if strings.Contains(location, "?") {
+		separator = "&"
+	}
+	res, err := c.do(http.MethodPut, location+separator+"digest="+url.QueryEscape(digest), map[string]string{"Content-Type": "application/octet-stream"}, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		return registryError("finishing upload of "+shortDigest(digest), res)
+	}
+	return nil
+}
+
+// location resolves the Location header of an upload response.
+func (c *registryClient) location(res *http.Response) (string, error) {
+	location := res.Header.Get("Location")
+	if location == "" {
+		return "", errors.New("registry did not return an upload location")
+	}
+	resolved, err := res.Request.URL.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	return resolved.String(), nil
+}
+
+// putManifest uploads a manifest under the reference's tag and returns its
+// digest, checking that the registry stored exactly the bytes sent.
+func (c *registryClient) putManifest(mediaType string, manifest []byte) (string, error) {
+	reference := c.ref.Tag
+	if reference == "" {
+		reference = sha256Digest(manifest)
+	}
+	res, err := c.do(http.MethodPut, fmt.Sprintf("/v2/%s/manifests/%s", c.ref.Repository, reference), map[string]string{"Content-Type": mediaType}, manifest)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		return "", registryError("uploading manifest", res)
+	}
+
+	digest := sha256Digest(manifest)
+	if stored := res.Header.Get("Docker-Content-Digest"); stored != "" && stored != digest {
+		return "", fmt.Errorf("registry stored the manifest as %s, expected %s", stored, digest)
+	}
+	return digest, nil
+}
+
+func registryError(action string, res *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	var parsed struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &parsed) == nil && len(parsed.Errors) > 0 {
+		return fmt.Errorf("%s: %s: %s", action, parsed.Errors[0].Code, parsed.Errors[0].Message)
+	}
+	return fmt.Errorf("%s: statuscode %d: %s", action, res.StatusCode, strings.TrimSpace(string(body)))
+}
+
+func shortDigest(digest string) string {
+	encoded := strings.TrimPrefix(digest, "sha256:")
+	if len(encoded) > 12 {
+		encoded = encoded[:12]
+	}
+	return encoded
+}
+
+// dockerCredentials reads the credentials for registry from docker's
+// config.json, asking a credential helper when one is configured.
+func dockerCredentials(registry string) (string, string, error) {
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", nil
+		}
+		configDir = filepath.Join(home, ".docker")
+	}
+
+	content, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		return "", "", nil
+	}
+	var config struct {
+		Auths map[string]struct {
+			Auth          string `json:"auth"`
+			IdentityToken string `json:"identitytoken"`
+		} `json:"auths"`
+		CredsStore  string            `json:"credsStore"`
+		CredHelpers map[string]string `json:"credHelpers"`
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return "", "", fmt.Errorf("parsing docker config.json: %w", err)
+	}
+
+	key := registry
+	if registry == dockerHubRegistry {
+		key = dockerHubAuthKey
+	}
+
+	helper := config.CredHelpers[key]
+	if helper == "" {
+		helper = config.CredsStore
+	}
+	if helper != "" {
+		if username, secret, err := credentialHelper(helper, key); err == nil {
+			return username, secret, nil
+		}
+	}
+
+	for server, auth := range config.Auths {
+		if server != key && strings.TrimPrefix(strings.TrimPrefix(strings.TrimSuffix(server, "/"), "https://"), "http://") != key {
+			continue
+		}
+		if auth.IdentityToken != "" {
+			return identityTokenUsername, auth.IdentityToken, nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return "", "", fmt.Errorf("decoding docker credentials for %s: %w", server, err)
+		}
+		username, password, _ := strings.Cut(string(decoded), ":")
+		return username, password, nil
+	}
+	return "", "", nil
+}
+
+func credentialHelper(helper, server string) (string, string, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", "", err
+	}
+	var credentials struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(output, &credentials); err != nil {
+		return "", "", err
+	}
+	return credentials.Username, credentials.Secret, nil
+}
@@ -0,0 +1,383 @@
+package project
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	testRegistryToken    = "registry-token"
+	testRegistryUsername = "ci"
+	testRegistryPassword = "hunter2"
+	testIdentityToken    = "refresh-me"
+)
+
+// fakeRegistry is a Distribution v2 registry that keeps blobs in memory and
+// only accepts requests with the bearer token it hands out at /token.
+type fakeRegistry struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	uploads   map[string][]byte
+	manifests map[string][]byte
+	requests  []string
+	grants    []string
+
+	// patches counts PATCH requests and failPatch is the one to reject,
+	// counting from one; wrongDigest makes manifest uploads report a digest
+	// other than the one of the bytes sent.
+	patches     int
+	failPatch   int
+	wrongDigest bool
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	t.Helper()
+	r := &fakeRegistry{blobs: map[string][]byte{}, uploads: map[string][]byte{}, manifests: map[string][]byte{}}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *fakeRegistry) host() string {
+	return strings.TrimPrefix(r.URL, "http://")
+}
+
+func (r *fakeRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req.URL.Path == "/token" {
+		r.serveToken(w, req)
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer "+testRegistryToken {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake-registry"`, r.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	request := req.Method + " " + req.URL.Path
+	if contentRange := req.Header.Get("Content-Range"); contentRange != "" {
+		request += " " + contentRange
+	}
+	r.requests = append(r.requests, request)
+
+	const prefix = "/v2/acme/worker/"
+	path := strings.TrimPrefix(req.URL.Path, prefix)
+	switch {
+	case req.Method == http.MethodHead && strings.HasPrefix(path, "blobs/sha256:"):
+		if _, ok := r.blobs[strings.TrimPrefix(path, "blobs/")]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case req.Method == http.MethodPost && path == "blobs/uploads/":
+		id := fmt.Sprintf("upload-%d", len(r.uploads)+1)
+		r.uploads[id] = nil
+		w.Header().Set("Location", prefix+"blobs/uploads/"+id)
+		w.WriteHeader(http.StatusAccepted)
+	case strings.HasPrefix(path, "blobs/uploads/"):
+		r.serveUpload(w, req, strings.TrimPrefix(path, "blobs/uploads/"))
+	case req.Method == http.MethodPut && strings.HasPrefix(path, "manifests/"):
+		body, _ := io.ReadAll(req.Body)
+		r.manifests[strings.TrimPrefix(path, "manifests/")] = body
+		digest := sha256Digest(body)
+		if r.wrongDigest {
+			digest = sha256Digest(append(body, '\n'))
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// serveToken hands out the token for the test credentials: basic auth on a
+// GET, or an identity token exchanged with a refresh_token grant.
+func (r *fakeRegistry) serveToken(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodPost {
+		req.ParseForm()
+		if req.PostForm.Get("grant_type") != "refresh_token" || req.PostForm.Get("refresh_token") != testIdentityToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.grants = append(r.grants, "refresh_token "+req.PostForm.Get("scope"))
+		json.NewEncoder(w).Encode(map[string]string{"access_token": testRegistryToken})
+		return
+	}
+	username, password, ok := req.BasicAuth()
+	if !ok || username != testRegistryUsername || password != testRegistryPassword {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	r.grants = append(r.grants, "basic "+req.URL.Query().Get("scope"))
+	json.NewEncoder(w).Encode(map[string]string{"token": testRegistryToken})
+}
+
+func (r *fakeRegistry) serveUpload(w http.ResponseWriter, req *http.Request, id string) {
+	received, ok := r.uploads[id]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	location := "/v2/acme/worker/blobs/uploads/" + id
+
+	switch req.Method {
+	case http.MethodGet:
+		// Like Distribution, an empty session is reported as 0-0.
+		w.Header().Set("Range", fmt.Sprintf("0-%d", max(len(received)-1, 0)))
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPatch:
+		r.patches++
+		if r.patches == r.failPatch {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var start, end int
+		fmt.Sscanf(req.Header.Get("Content-Range"), "%d-%d", &start, &end)
+		if start != len(received) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		r.uploads[id] = append(received, body...)
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		digest := req.URL.Query().Get("digest")
+		if sha256Digest(received) != digest {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors":[{"code":"DIGEST_INVALID","message":"digest did not match"}]}`)
+			return
+		}
+		r.blobs[digest] = received
+		delete(r.uploads, id)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// newTestRegistryClient writes a docker config.json with auth for the fake
+// registry and returns a client for acme/worker:v1 on it.
+func newTestRegistryClient(t *testing.T, registry *fakeRegistry, auth map[string]string, chunkSize int64) *registryClient {
+	t.Helper()
+	configDir := t.TempDir()
+	content, err := json.Marshal(map[string]any{"auths": map[string]any{registry.host(): auth}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, "config.json"), content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DOCKER_CONFIG", configDir)
+
+	ref := imageReference{Registry: registry.host(), Repository: "acme/worker", Tag: "v1"}
+	client, err := newRegistryClient(ref, true, chunkSize)
+	if err != nil {
+		t.Fatalf("newRegistryClient: %v", err)
+	}
+	return client
+}
+
+func TestPushImageBlobs(t *testing.T) {
+	tests := []struct {
+		name      string
+		auth      map[string]string
+		wantGrant string
+	}{
+		{
+			name:      "basic credentials",
+			auth:      map[string]string{"auth": base64.StdEncoding.EncodeToString([]byte(testRegistryUsername + ":" + testRegistryPassword))},
+			wantGrant: "basic repository:acme/worker:pull,push",
+		},
+		{
+			name:      "identity token",
+			auth:      map[string]string{"identitytoken": testIdentityToken},
+			wantGrant: "refresh_token repository:acme/worker:pull,push",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			base := writeTestBaseLayout(t, false, false)
+			_, manifest, err := base.layout.resolveImage(base.ref, ociPlatform{OS: "linux", Architecture: "amd64"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			layer, err := base.layout.readBlob(base.layer.Digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config, err := base.layout.readBlob(manifest.Config.Digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The registry already has the config, and drops the second chunk
+			// of the layer once.
+			registry := newFakeRegistry(t)
+			registry.blobs[manifest.Config.Digest] = config
+			registry.failPatch = 2
+			chunkSize := int64(len(layer)/3 + 1)
+			client := newTestRegistryClient(t, registry, test.auth, chunkSize)
+			sessions := loadUploadSessions(filepath.Join(t.TempDir(), ".runpod", "uploads.json"))
+
+			if err := pushImageBlobs(client, base.layout, manifest, sessions); err != nil {
+				t.Fatalf("pushImageBlobs: %v", err)
+			}
+
+			if got := registry.blobs[base.layer.Digest]; string(got) != string(layer) {
+				t.Errorf("registry stored %d bytes for the layer, want %d", len(got), len(layer))
+			}
+			if !reflect.DeepEqual(registry.grants, []string{test.wantGrant}) {
+				t.Errorf("token grants = %q, want %q", registry.grants, []string{test.wantGrant})
+			}
+
+			upload := "/v2/acme/worker/blobs/uploads/upload-1"
+			chunk := func(start, end int64) string {
+				return fmt.Sprintf("PATCH %s %d-%d", upload, start, min(end, int64(len(layer)))-1)
+			}
+			want := []string{
+				"HEAD /v2/acme/worker/blobs/" + base.layer.Digest,
+				"POST /v2/acme/worker/blobs/uploads/",
+				chunk(0, chunkSize),
+				chunk(chunkSize, 2*chunkSize),
+				"GET " + upload,
+				chunk(chunkSize, 2*chunkSize),
+				chunk(2*chunkSize, 3*chunkSize),
+				"PUT " + upload,
+				"HEAD /v2/acme/worker/blobs/" + manifest.Config.Digest,
+			}
+			if !reflect.DeepEqual(registry.requests, want) {
+				t.Errorf("registry requests =\n%s\nwant\n%s", strings.Join(registry.requests, "\n"), strings.Join(want, "\n"))
+			}
+			if len(sessions.Sessions) != 0 {
+				t.Errorf("finished upload is still recorded: %v", sessions.Sessions)
+			}
+		})
+	}
+}
+
+func TestUploadBlobResumesSession(t *testing.T) {
+	content := []byte("0123456789")
+	upload := func(id int) string {
+		return fmt.Sprintf("/v2/acme/worker/blobs/uploads/upload-%d", id)
+	}
+	tests := []struct {
+		name string
+		// received is what the registry holds for the session of an earlier
+		// push, offset what that push recorded.
+		received []byte
+		offset   int64
+		want     []string
+	}{
+		{
+			name:     "partial upload",
+			received: content[:4],
+			offset:   4,
+			want:     []string{"GET " + upload(1), "PATCH " + upload(1) + " 4-7", "PATCH " + upload(1) + " 8-9", "PUT " + upload(1)},
+		},
+		{
+			name:     "empty upload",
+			received: []byte{},
+			offset:   0,
+			want:     []string{"GET " + upload(1), "PATCH " + upload(1) + " 0-3", "PATCH " + upload(1) + " 4-7", "PATCH " + upload(1) + " 8-9", "PUT " + upload(1)},
+		},
+		{
+			name:     "offsets disagree",
+			received: content[:4],
+			offset:   8,
+			want:     []string{"GET " + upload(1), "POST /v2/acme/worker/blobs/uploads/", "PATCH " + upload(2) + " 0-3", "PATCH " + upload(2) + " 4-7", "PATCH " + upload(2) + " 8-9", "PUT " + upload(2)},
+		},
+		{
+			name:     "single byte reported as empty",
+			received: content[:1],
+			offset:   0,
+			want:     []string{"GET " + upload(1), "PATCH " + upload(1) + " 0-3", "POST /v2/acme/worker/blobs/uploads/", "PATCH " + upload(2) + " 0-3", "PATCH " + upload(2) + " 4-7", "PATCH " + upload(2) + " 8-9", "PUT " + upload(2)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry := newFakeRegistry(t)
+			client := newTestRegistryClient(t, registry, map[string]string{"identitytoken": testIdentityToken}, 4)
+
+			blobPath := filepath.Join(t.TempDir(), "blob")
+			if err := os.WriteFile(blobPath, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			digest := sha256Digest(content)
+
+			registry.uploads["upload-1"] = test.received
+			sessionsPath := filepath.Join(t.TempDir(), "uploads.json")
+			sessions := loadUploadSessions(sessionsPath)
+			sessionKey := registry.host() + "/acme/worker@" + digest
+			if err := sessions.set(sessionKey, registry.URL+upload(1), test.offset); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := client.uploadBlob(blobPath, digest, loadUploadSessions(sessionsPath)); err != nil {
+				t.Fatalf("uploadBlob: %v", err)
+			}
+
+			if got := registry.blobs[digest]; string(got) != string(content) {
+				t.Errorf("registry stored %q, want %q", got, content)
+			}
+			if !reflect.DeepEqual(registry.requests, test.want) {
+				t.Errorf("registry requests =\n%s\nwant\n%s", strings.Join(registry.requests, "\n"), strings.Join(test.want, "\n"))
+			}
+			if saved := loadUploadSessions(sessionsPath); len(saved.Sessions) != 0 {
+				t.Errorf("finished upload is still recorded: %v", saved.Sessions)
+			}
+		})
+	}
+}
+
+func TestPutManifestDigest(t *testing.T) {
+	tests := []struct {
+		name        string
+		wrongDigest bool
+		wantErr     string
+	}{
+		{name: "matching digest"},
+		{name: "registry changed the manifest", wrongDigest: true, wantErr: "registry stored the manifest as"},
+	}
+
+	manifest := []byte(`{"schemaVersion":2}`)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry := newFakeRegistry(t)
+			registry.wrongDigest = test.wrongDigest
+			client := newTestRegistryClient(t, registry, map[string]string{"identitytoken": testIdentityToken}, 4)
+
+			digest, err := client.putManifest(mediaTypeOCIImage, manifest)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("putManifest error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("putManifest: %v", err)
+			}
+			if want := sha256Digest(manifest); digest != want {
+				t.Errorf("putManifest digest = %s, want %s", digest, want)
+			}
+			if got := registry.manifests["v1"]; string(got) != string(manifest) {
+				t.Errorf("registry stored manifest %q, want %q", got, manifest)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package project
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	secretsFile          string = "secrets.enc"
+	secretsPassphraseEnv string = "AIRFOIL_SECRETS_PASSPHRASE"
+)
+
+// secretsEnvelope is the on-disk format of secrets.enc. The plaintext is a
+// JSON object of secret names to values, sealed with AES-256-GCM using a key
+// derived from the passphrase with scrypt.
+type secretsEnvelope struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type projectSecrets struct {
+	path   string
+	salt   []byte
+	values map[string]string
+	key    []byte
+}
+
+var SecretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage encrypted project secrets",
+	Long: `Manages secrets stored encrypted in secrets.enc next to runpod.toml.
+The file can be committed; secrets are injected into the pod and template environment by dev and deploy.
+The encryption passphrase is read from ` + secretsPassphraseEnv + `, the secretsKey setting in the config file, or prompted for.`,
+}
+
+var secretsSetCmd = &cobra.Command{
+	Use:   "set KEY VALUE",
+	Short: "Set a secret",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		secrets, err := openCurrentProjectSecrets()
+		cobra.CheckErr(err)
+
+		secrets.values[args[0]] = args[1]
+		cobra.CheckErr(secrets.save())
+		fmt.Printf("Secret %s saved to %s\n", args[0], secretsFile)
+	},
+}
+
+var secretsGetCmd = &cobra.Command{
+	Use:   "get KEY",
+	Short: "Print the value of a secret",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		secrets, err := openCurrentProjectSecrets()
+		cobra.CheckErr(err)
+
+		value, ok := secrets.values[args[0]]
+		if !ok {
+			cobra.CheckErr(fmt.Errorf("secret %s not found", args[0]))
+		}
+		fmt.Println(value)
+	},
+}
+
+var secretsListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List secret names",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		secrets, err := openCurrentProjectSecrets()
+		cobra.CheckErr(err)
+
+		for _, key := range secrets.keys() {
+			fmt.Println(key)
+		}
+	},
+}
+
+var secretsRmCmd = &cobra.Command{
+	Use:     "rm KEY",
+	Aliases: []string{"remove"},
+	Short:   "Remove a secret",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		secrets, err := openCurrentProjectSecrets()
+		cobra.CheckErr(err)
+
+		if _, ok := secrets.values[args[0]]; !ok {
+			cobra.CheckErr(fmt.Errorf("secret %s not found", args[0]))
+		}
+		delete(secrets.values, args[0])
+		cobra.CheckErr(secrets.save())
+		fmt.Printf("Secret %s removed from %s\n", args[0], secretsFile)
+	},
+}
+
+func init() {
+	SecretsCmd.AddCommand(secretsSetCmd)
+	SecretsCmd.AddCommand(secretsGetCmd)
+	SecretsCmd.AddCommand(secretsListCmd)
+	SecretsCmd.AddCommand(secretsRmCmd)
+}
+
+// secretsPassphrase returns the passphrase of secrets.enc. A prompted
+// passphrase is asked for twice when confirm is set, as it is the one a new
+// file will be encrypted with.
+func secretsPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(secretsPassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if passphrase := viper.GetString("secretsKey"); passphrase != "" {
+		return passphrase, nil
+	}
+
+	prompt := promptui.Prompt{
+		Label: "Secrets passphrase",
+		Mask:  '*',
+	}
+	passphrase, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("secrets passphrase must not be empty")
+	}
+	if !confirm {
+		return passphrase, nil
+	}
+
+	confirmPrompt := promptui.Prompt{
+		Label: "Confirm secrets passphrase",
+		Mask:  '*',
+	}
+	confirmation, err := confirmPrompt.Run()
+	if err != nil {
+		return "", err
+	}
+	if confirmation != passphrase {
+		return "", errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+func deriveSecretsKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+// openProjectSecrets decrypts secrets.enc in projectDir, or prepares an empty
+// set of secrets when the file does not exist yet.
+func openProjectSecrets(projectDir string) (*projectSecrets, error) {
+	secrets := &projectSecrets{
+		path:   filepath.Join(projectDir, secretsFile),
+		values: map[string]string{},
+	}
+
+	content, err := os.ReadFile(secrets.path)
+	if errors.Is(err, os.ErrNotExist) {
+		passphrase, err := secretsPassphrase(true)
+		if err != nil {
+			return nil, fmt.Errorf("reading secrets passphrase: %w", err)
+		}
+		secrets.salt = make([]byte, 16)
+		if _, err := rand.Read(secrets.salt); err != nil {
+			return nil, err
+		}
+		secrets.key, err = deriveSecretsKey(passphrase, secrets.salt)
+		return secrets, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", secretsFile, err)
+	}
+
+	var envelope secretsEnvelope
+	if err := json.Unmarshal(content, &envelope); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", secretsFile, err)
+	}
+	if envelope.Version != 1 {
+		return nil, fmt.Errorf("unsupported %s version %d", secretsFile, envelope.Version)
+	}
+
+	passphrase, err := secretsPassphrase(false)
+	if err != nil {
+		return nil, fmt.Errorf("reading secrets passphrase: %w", err)
+	}
+
+	secrets.salt = envelope.Salt
+	secrets.key, err = deriveSecretsKey(passphrase, envelope.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newSecretsCipher(secrets.key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, envelope.Nonce, envelope.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s: wrong passphrase or corrupted file", secretsFile)
+	}
+	if err := json.Unmarshal(plaintext, &secrets.values); err != nil {
+		return nil, fmt.Errorf("parsing decrypted %s: %w", secretsFile, err)
+	}
+
+	return secrets, nil
+}
+
+func newSecretsCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *projectSecrets) save() error {
+	plaintext, err := json.Marshal(s.values)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newSecretsCipher(s.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	envelope := secretsEnvelope{
+		Version:    1,
+		Salt:       s.salt,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plaintext, nil),
+	}
+	content, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Only the owner needs to read the file, even though its contents are
+	// encrypted. WriteFile keeps the mode of an existing file.
+	if err := os.WriteFile(s.path, append(content, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Chmod(s.path, 0600)
+}
+
+func (s *projectSecrets) keys() []string {
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// openCurrentProjectSecrets opens the secrets.enc next to the runpod.toml of
+// the project in the current folder.
+func openCurrentProjectSecrets() (*projectSecrets, error) {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+	return openProjectSecrets(config.Dir())
+}
+
+// loadProjectSecrets returns the decrypted secrets of the project, or nil
+// when the project has no secrets.enc.
+func loadProjectSecrets(projectDir string) (map[string]string, error) {
+	if _, err := os.Stat(filepath.Join(projectDir, secretsFile)); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	secrets, err := openProjectSecrets(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	return secrets.values, nil
+}
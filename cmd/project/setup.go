@@ -0,0 +1,75 @@
+package project
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// aptPackageFormat accepts a Debian package name, optionally pinned with
+// =version or a target release with /release.
+var aptPackageFormat = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]*([=/][A-Za-z0-9+.~:_-]+)?$`)
+
+// validateRuntimeSetup checks runtime.system_packages and runtime.build_steps.
+func validateRuntimeSetup(config *ProjectConfig) error {
+	for _, pkg := range config.Runtime.SystemPackages {
+		if !aptPackageFormat.MatchString(pkg) {
+			return fmt.Errorf("invalid package %q in runtime.system_packages", pkg)
+		}
+	}
+	for i, step := range config.Runtime.BuildSteps {
+		if strings.TrimSpace(step) == "" {
+			return fmt.Errorf("runtime.build_steps[%d] is empty", i)
+		}
+		if strings.ContainsAny(step, "\r\n") {
+			return fmt.Errorf("runtime.build_steps[%d] must be a single line, join commands with &&", i)
+		}
+	}
+	return nil
+}
+
+// aptInstallCommand returns the shell command installing packages, cleaning
+// up the package lists afterwards to keep image layers small.
+func aptInstallCommand(packages []string, separator string) string {
+	return strings.Join([]string{
+		"apt-get update",
+		"DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends " + strings.Join(packages, " "),
+		"rm -rf /var/lib/apt/lists/*",
+	}, " &&"+separator)
+}
+
+// dockerfileSystemPackages returns the RUN instruction installing the system
+// packages of the project, or an empty string when there are none.
+func dockerfileSystemPackages(config *ProjectConfig) string {
+	if len(config.Runtime.SystemPackages) == 0 {
+		return ""
+	}
+	return "RUN " + aptInstallCommand(config.Runtime.SystemPackages, " \\\n    ") + "\n"
+}
+
+// dockerfileBuildSteps returns a RUN instruction per build step. Steps run
+// from the project root, like they do on the development pod.
+func dockerfileBuildSteps(config *ProjectConfig) string {
+	if len(config.Runtime.BuildSteps) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n# Build steps\nWORKDIR /\n")
+	for _, step := range config.Runtime.BuildSteps {
+		fmt.Fprintf(&b, "RUN %s\n", step)
+	}
+	return b.String()
+}
+
+// devSystemPackagesCommand installs the system packages on the development
+// pod unless dpkg already knows all of them, so restarting a session on the
+// same pod does not hit the package mirrors again.
+func devSystemPackagesCommand(packages []string) string {
+	names := make([]string, 0, len(packages))
+	for _, pkg := range packages {
+		name, _, _ := strings.Cut(pkg, "=")
+		name, _, _ = strings.Cut(name, "/")
+		names = append(names, name)
+	}
+	return fmt.Sprintf("dpkg -s %s >/dev/null 2>&1 || (%s)", strings.Join(names, " "), aptInstallCommand(packages, " "))
+}
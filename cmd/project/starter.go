@@ -0,0 +1,120 @@
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+func normalizeTemplateName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+}
+
+// resolveStarterTemplate returns the starter template for a model type such
+// as "LLM", "stable-diffusion" or one of the aliases in its manifest.
+func resolveStarterTemplate(modelType string) (*TemplateManifest, error) {
+	manifests, err := listStarterTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	key := normalizeTemplateName(modelType)
+	if key == "" {
+		key = normalizeTemplateName("Hello_World")
+	}
+
+	names := make([]string, 0, len(manifests))
+	for _, manifest := range manifests {
+		if normalizeTemplateName(manifest.Name) == key {
+			return manifest, nil
+		}
+		for _, alias := range manifest.Aliases {
+			if normalizeTemplateName(alias) == key {
+				return manifest, nil
+			}
+		}
+		names = append(names, manifest.Name)
+	}
+
+	return nil, fmt.Errorf("unknown model type %q, choose one of: %s", modelType, strings.Join(names, ", "))
+}
+
+// starterTemplateNames returns the names of the embedded starter templates.
+func starterTemplateNames() []string {
+	manifests, err := listStarterTemplates()
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(manifests))
+	for _, manifest := range manifests {
+		names = append(names, manifest.Name)
+	}
+	return names
+}
+
+// starterTemplateHelp describes the embedded starter templates and their
+// variables for the create command's help text.
+func starterTemplateHelp() string {
+	manifests, err := listStarterTemplates()
+	if err != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n\nStarter templates:\n")
+	for _, manifest := range manifests {
+		fmt.Fprintf(&b, "  %-18s %s\n", manifest.Name, manifest.Description)
+		for _, variable := range manifest.Variables {
+			fmt.Fprintf(&b, "    --var %s=%s\t%s\n", variable.Name, variable.Default, variable.Prompt)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// templateVars are the values available to starter template files.
+type templateVars struct {
+	ProjectName   string
+	ModelType     string
+	ModelName     string
+	CudaVersion   string
+	PythonVersion string
+	Runpod        string
+	// Vars holds the variables declared in the template manifest.
+	Vars map[string]string
+}
+
+// templatePlaceholder matches a <<NAME>> placeholder, e.g. <<MODEL_NAME>>.
+var templatePlaceholder = regexp.MustCompile(`<<([A-Z][A-Z0-9_]*)>>`)
+
+// renderTemplate substitutes the placeholders of a starter template file.
+// Only the built-in names and the variables declared in the manifest are
+// replaced; anything else, including shifts, heredocs and unknown
+// placeholders, is kept as is. Binary files are copied unchanged.
+func renderTemplate(content []byte, vars templateVars) []byte {
+	if bytes.IndexByte(content, 0) >= 0 || !utf8.Valid(content) {
+		return content
+	}
+
+	values := map[string]string{}
+	for key, value := range vars.Vars {
+		values[key] = value
+	}
+	values["PROJECT_NAME"] = vars.ProjectName
+	values["MODEL_TYPE"] = vars.ModelType
+	values["MODEL_NAME"] = vars.ModelName
+	values["CUDA_VERSION"] = vars.CudaVersion
+	values["PYTHON_VERSION"] = vars.PythonVersion
+	values["RUNPOD"] = vars.Runpod
+
+	return templatePlaceholder.ReplaceAllFunc(content, func(placeholder []byte) []byte {
+		name := string(placeholder[2 : len(placeholder)-2])
+		if value, ok := values[name]; ok {
+			return []byte(value)
+		}
+		return placeholder
+	})
+}
@@ -7,7 +7,7 @@ def handler(job):
     This is the handler function for the job.
     '''
     job_input = job['input']
-    name = job_input.get('name', 'World')
+    name = job_input.get('name', '<<DEFAULT_NAME>>')
     return f"Hello, {name}!"
 
 runpod.serverless.start({"handler": handler})
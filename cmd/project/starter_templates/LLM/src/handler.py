@@ -27,7 +27,7 @@ def handler(job: Dict[str, any]) -> str:
     input_text = job_input['text']
 
     input_ids = tokenizer(input_text, return_tensors="pt").input_ids.to("cuda")
-    outputs = model.generate(input_ids)
+    outputs = model.generate(input_ids, max_new_tokens=<<MAX_NEW_TOKENS>>)
     response = tokenizer.decode(outputs[0])
 
     return response
@@ -29,7 +29,7 @@ def handler(job: Dict[str, any]) -> str:
     job_input = job['input']
     prompt = job_input['prompt']
 
-    image = pipe(prompt=prompt, num_inference_steps=1, guidance_scale=0.0).images[0]
+    image = pipe(prompt=prompt, num_inference_steps=<<INFERENCE_STEPS>>, guidance_scale=0.0).images[0]
 
     with io.BytesIO() as buffer:
         image.save(buffer, format="PNG")
@@ -27,7 +27,7 @@ def handler(job):
     prompt = job['input']['prompt']
     print(f"Received prompt: {prompt}")
 
-    result = synthesizer(prompt, forward_params={"do_sample": True, "max_new_tokens":300})
+    result = synthesizer(prompt, forward_params={"do_sample": True, "max_new_tokens": <<MAX_NEW_TOKENS>>})
 
     audio_data = result['audio']
     sample_rate = result['sampling_rate']
@@ -0,0 +1,605 @@
+package project
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/yourusername/airfoil/api"
+	"github.com/yourusername/airfoil/format"
+)
+
+// projectStateFile records which remote resources belong to a project. It
+// lives next to runpod.toml and is not meant to be edited or committed.
+const projectStateFile string = ".runpod/state.json"
+
+const (
+	projectStateVersion   int    = 1
+	defaultEnvironment    string = "default"
+	projectEnvironmentEnv string = "AIRFOIL_ENVIRONMENT"
+
+	stateLockTimeout    = 10 * time.Second
+	stateLockStaleAfter = time.Minute
+)
+
+var environmentFormat = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+var (
+	projectEnvironment string
+	forgetAll          bool
+)
+
+// stateFile is the on-disk format of projectStateFile. Projects are keyed by
+// uuid, so a copied project folder does not adopt the resources of the
+// original, and each project has named environments. The image is shared by
+// all environments of a project.
+type stateFile struct {
+	Version  int                           `json:"version"`
+	Projects map[string]*projectStateEntry `json:"projects"`
+}
+
+type projectStateEntry struct {
+	Image        *ImageState                  `json:"image,omitempty"`
+	Environments map[string]*environmentState `json:"environments,omitempty"`
+}
+
+type environmentState struct {
+	Pod           *PodState           `json:"pod,omitempty"`
+	Endpoint      *EndpointState      `json:"endpoint,omitempty"`
+	Canary        *EndpointState      `json:"canary,omitempty"`
+	NetworkVolume *NetworkVolumeState `json:"networkVolume,omitempty"`
+	History       []DeployRecord      `json:"history,omitempty"`
+}
+
+// ProjectState is the state of one project environment.
+type ProjectState struct {
+	Image         *ImageState
+	Pod           *PodState
+	Endpoint      *EndpointState
+	NetworkVolume *NetworkVolumeState
+	// Canary is the canary endpoint of a canary deploy not yet promoted.
+	Canary *EndpointState
+	// History lists the deploys of the environment, oldest first.
+	History []DeployRecord
+
+	uuid        string
+	environment string
+	// dir is the project directory the state belongs to.
+	dir string
+	// loaded holds the parts as they were read, so save only writes the
+	// parts this command changed and keeps concurrent changes to the others.
+	loaded map[string]string
+}
+
+// ImageState describes the last image built for the project.
+type ImageState struct {
+	Tag     string    `json:"tag"`
+	Builder string    `json:"builder"`
+	Pushed  bool      `json:"pushed"`
+	BuiltAt time.Time `json:"builtAt"`
+	// Digest and Layout are set for images assembled by airfoil image build.
+	Digest string `json:"digest,omitempty"`
+	Layout string `json:"layout,omitempty"`
+	// ContentHash identifies the Dockerfile, build context and build
+	// arguments the image was built from.
+	ContentHash string `json:"contentHash,omitempty"`
+	// The git checkout the image was built from, which deploys of the image
+	// record.
+	gitRevision
+}
+
+// PodState describes the development pod of an environment.
+type PodState struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// EndpointState describes the endpoint the project was last deployed to.
+type EndpointState struct {
+	Id           string    `json:"id"`
+	Name         string    `json:"name"`
+	TemplateId   string    `json:"templateId"`
+	TemplateName string    `json:"templateName"`
+	Image        string    `json:"image"`
+	DeployedAt   time.Time `json:"deployedAt"`
+	gitRevision
+}
+
+// DeployRecord is a deploy or rollback of an environment.
+type DeployRecord struct {
+	EndpointId   string    `json:"endpointId"`
+	TemplateId   string    `json:"templateId"`
+	TemplateName string    `json:"templateName"`
+	Image        string    `json:"image"`
+	User         string    `json:"user"`
+	DeployedAt   time.Time `json:"deployedAt"`
+	// RollbackOf is the template the endpoint was rolled back from.
+	RollbackOf string `json:"rollbackOf,omitempty"`
+	// Tag is the git tag created for the deploy by --tag-release.
+	Tag string `json:"tag,omitempty"`
+	gitRevision
+}
+
+// NetworkVolumeState is the network volume chosen for the environment.
+type NetworkVolumeState struct {
+	Id           string `json:"id"`
+	Name         string `json:"name"`
+	DataCenterId string `json:"dataCenterId"`
+}
+
+var StateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Inspect the remote resources linked to the project",
+	Long: `Shows and maintains ` + projectStateFile + `, which links the project to its pods, templates,
+endpoints and network volumes per environment. The environment is chosen with --environment
+or ` + projectEnvironmentEnv + `, and is "` + defaultEnvironment + `" otherwise.`,
+}
+
+var stateShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the resources linked to the project",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := showProjectState(); err != nil {
+			fmt.Println("Failed to show project state:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var stateRefreshCmd = &cobra.Command{
+	Use:   "refresh",
+	Short: "Reconcile the state with the pods and endpoints on RunPod",
+	Long: `Checks the pod, endpoint and network volume of the environment against RunPod.
+Resources that no longer exist are removed from the state, and a pod or endpoint
+created for the environment but missing from the state is added back.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := refreshProjectState(); err != nil {
+			fmt.Println("Failed to refresh project state:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var stateForgetCmd = &cobra.Command{
+	Use:   "forget",
+	Short: "Remove the environment from the state, leaving its resources running",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := forgetProjectState(); err != nil {
+			fmt.Println("Failed to forget project state:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	StateCmd.AddCommand(stateShowCmd)
+	StateCmd.AddCommand(stateRefreshCmd)
+	StateCmd.AddCommand(stateForgetCmd)
+
+	addEnvironmentFlag(StateCmd)
+	stateForgetCmd.Flags().BoolVar(&forgetAll, "all", false, "Forget every environment and the image of the project")
+}
+
+// addEnvironmentFlag registers --environment on cmd and its subcommands.
+func addEnvironmentFlag(cmd *cobra.Command) {
+	value := os.Getenv(projectEnvironmentEnv)
+	if value == "" {
+		value = defaultEnvironment
+	}
+	cmd.PersistentFlags().StringVar(&projectEnvironment, "environment", value, "Project environment to use, such as staging or production")
+}
+
+// currentEnvironment returns the selected environment name.
+func currentEnvironment() (string, error) {
+	environment := projectEnvironment
+	if environment == "" {
+		environment = defaultEnvironment
+	}
+	if !environmentFormat.MatchString(environment) {
+		return "", fmt.Errorf("invalid environment %q, use lowercase letters, digits, - and _", environment)
+	}
+	return environment, nil
+}
+
+// environmentResourceName returns the name of a resource of the project in
+// the current environment. The default environment keeps the plain names.
+func environmentResourceName(config *ProjectConfig, kind string) string {
+	if projectEnvironment == "" || projectEnvironment == defaultEnvironment {
+		return fmt.Sprintf("%s-%s (%s)", config.Name, kind, config.Project.Uuid)
+	}
+	return fmt.Sprintf("%s-%s-%s (%s)", config.Name, projectEnvironment, kind, config.Project.Uuid)
+}
+
+// loadProjectState reads the state of the current environment of the
+// project in config.Dir(). A missing file yields an empty state.
+func loadProjectState(config *ProjectConfig) (*ProjectState, error) {
+	environment, err := currentEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := readStateFile(config.Dir())
+	if err != nil {
+		return nil, err
+	}
+
+	state := &ProjectState{uuid: config.Project.Uuid, environment: environment, dir: config.Dir()}
+	if entry := file.Projects[state.uuid]; entry != nil {
+		state.Image = entry.Image
+		if env := entry.Environments[environment]; env != nil {
+			state.Pod, state.Endpoint, state.NetworkVolume = env.Pod, env.Endpoint, env.NetworkVolume
+			state.History, state.Canary = env.History, env.Canary
+		}
+	}
+	state.loaded = state.parts()
+	return state, nil
+}
+
+// parts returns the JSON encoding of each part of the state.
+func (s *ProjectState) parts() map[string]string {
+	encode := func(v any) string {
+		content, _ := json.Marshal(v)
+		return string(content)
+	}
+	return map[string]string{
+		"image":         encode(s.Image),
+		"pod":           encode(s.Pod),
+		"endpoint":      encode(s.Endpoint),
+		"networkVolume": encode(s.NetworkVolume),
+		"history":       encode(s.History),
+		"canary":        encode(s.Canary),
+	}
+}
+
+// save writes the parts of the state that changed since it was loaded. The
+// file is locked while it is read and rewritten, and replaced atomically so
+// an interrupted write never leaves a truncated file behind.
+func (s *ProjectState) save() error {
+	current := s.parts()
+	err := updateStateFile(s.dir, func(file *stateFile) error {
+		entry := file.Projects[s.uuid]
+		if entry == nil {
+			entry = &projectStateEntry{}
+			file.Projects[s.uuid] = entry
+		}
+		if entry.Environments == nil {
+			entry.Environments = map[string]*environmentState{}
+		}
+		env := entry.Environments[s.environment]
+		if env == nil {
+			env = &environmentState{}
+			entry.Environments[s.environment] = env
+		}
+
+		if current["image"] != s.loaded["image"] {
+			entry.Image = s.Image
+		}
+		if current["pod"] != s.loaded["pod"] {
+			env.Pod = s.Pod
+		}
+		if current["endpoint"] != s.loaded["endpoint"] {
+			env.Endpoint = s.Endpoint
+		}
+		if current["networkVolume"] != s.loaded["networkVolume"] {
+			env.NetworkVolume = s.NetworkVolume
+		}
+		if current["history"] != s.loaded["history"] {
+			env.History = s.History
+		}
+		if current["canary"] != s.loaded["canary"] {
+			env.Canary = s.Canary
+		}
+		pruneStateFile(file)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.loaded = current
+	return nil
+}
+
+// pruneStateFile drops empty environments and projects.
+func pruneStateFile(file *stateFile) {
+	for uuid, entry := range file.Projects {
+		for name, env := range entry.Environments {
+			if env.Pod == nil && env.Endpoint == nil && env.NetworkVolume == nil && env.Canary == nil && len(env.History) == 0 {
+				delete(entry.Environments, name)
+			}
+		}
+		if entry.Image == nil && len(entry.Environments) == 0 {
+			delete(file.Projects, uuid)
+		}
+	}
+}
+
+func readStateFile(dir string) (*stateFile, error) {
+	file := &stateFile{Version: projectStateVersion, Projects: map[string]*projectStateEntry{}}
+
+	content, err := os.ReadFile(filepath.Join(dir, projectStateFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return file, nil
+		}
+		return nil, fmt.Errorf("reading %s: %w", projectStateFile, err)
+	}
+	if err := json.Unmarshal(content, file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", projectStateFile, err)
+	}
+	if file.Version > projectStateVersion {
+		return nil, fmt.Errorf("%s was written by a newer version of airfoil", projectStateFile)
+	}
+	if file.Projects == nil {
+		file.Projects = map[string]*projectStateEntry{}
+	}
+	file.Version = projectStateVersion
+	return file, nil
+}
+
+// updateStateFile applies update to the state file while holding its lock.
+func updateStateFile(dir string, update func(file *stateFile) error) error {
+	statePath := filepath.Join(dir, projectStateFile)
+	if err := os.MkdirAll(filepath.Dir(statePath), 0755); err != nil {
+		return err
+	}
+
+	unlock, err := lockStateFile(statePath + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	file, err := readStateFile(dir)
+	if err != nil {
+		return err
+	}
+	if err := update(file); err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(statePath), ".state-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(content, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), statePath); err != nil {
+		return fmt.Errorf("writing %s: %w", projectStateFile, err)
+	}
+	return nil
+}
+
+// lockStateFile creates the lock file at path, waiting for another airfoil
+// process to release it. A lock left behind by a crashed process is taken
+// over once it is older than stateLockStaleAfter.
+func lockStateFile(path string) (func(), error) {
+	deadline := time.Now().Add(stateLockTimeout)
+	for {
+		lock, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintln(lock, strconv.Itoa(os.Getpid()))
+			lock.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("locking %s: %w", projectStateFile, err)
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > stateLockStaleAfter {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is locked by another airfoil process, remove %s if none is running", projectStateFile, path)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Reference returns the image reference to deploy: pinned to the digest once
+// the image has been pushed by digest, otherwise the tag.
+func (i *ImageState) Reference() string {
+	if i.Digest == "" || !i.Pushed {
+		return i.Tag
+	}
+	name, _, _ := strings.Cut(i.Tag, "@")
+	return name + "@" + i.Digest
+}
+
+func showProjectState() error {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	file, err := readStateFile(config.Dir())
+	if err != nil {
+		return err
+	}
+
+	entry := file.Projects[config.Project.Uuid]
+	if entry == nil {
+		fmt.Printf("No resources recorded for %s (%s)\n", config.Name, config.Project.Uuid)
+		return nil
+	}
+
+	if entry.Image != nil {
+		pushed := "not pushed"
+		if entry.Image.Pushed {
+			pushed = "pushed"
+		}
+		from := ""
+		if short := entry.Image.ShortCommit(); short != "" {
+			from = " from " + short
+		}
+		fmt.Printf("Image: %s (%s, built with %s at %s%s)\n", entry.Image.Reference(), pushed, entry.Image.Builder, entry.Image.BuiltAt.Format(time.RFC3339), from)
+	}
+	if len(entry.Environments) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(entry.Environments))
+	for name := range entry.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Environment", "Resource", "Id", "Details"})
+	format.TableDefaults(table)
+	for _, name := range names {
+		env := entry.Environments[name]
+		if env.Pod != nil {
+			table.Append([]string{name, "pod", env.Pod.Id, env.Pod.Name})
+		}
+		if env.Endpoint != nil {
+			table.Append([]string{name, "endpoint", env.Endpoint.Id, env.Endpoint.Name})
+			table.Append([]string{name, "template", env.Endpoint.TemplateId, env.Endpoint.Image})
+		}
+		if env.Canary != nil {
+			table.Append([]string{name, "canary", env.Canary.Id, env.Canary.Name})
+			table.Append([]string{name, "canary template", env.Canary.TemplateId, env.Canary.Image})
+		}
+		if env.NetworkVolume != nil {
+			table.Append([]string{name, "network volume", env.NetworkVolume.Id, fmt.Sprintf("%s (%s)", env.NetworkVolume.Name, env.NetworkVolume.DataCenterId)})
+		}
+	}
+	fmt.Println()
+	table.Render()
+	return nil
+}
+
+func refreshProjectState() error {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	state, err := loadProjectState(config)
+	if err != nil {
+		return err
+	}
+
+	pods, err := api.GetPods()
+	if err != nil {
+		return fmt.Errorf("getting pods: %w", err)
+	}
+	endpoints, err := api.GetEndpoints()
+	if err != nil {
+		return fmt.Errorf("getting endpoints: %w", err)
+	}
+	volumes, err := api.GetNetworkVolumes()
+	if err != nil {
+		return fmt.Errorf("getting network volumes: %w", err)
+	}
+
+	podName := environmentResourceName(config, "dev")
+	var pod *api.Pod
+	for _, candidate := range pods {
+		if (state.Pod != nil && candidate.Id == state.Pod.Id) || (pod == nil && candidate.Name == podName) {
+			pod = candidate
+		}
+	}
+	switch {
+	case pod == nil && state.Pod != nil:
+		fmt.Printf("Pod %s no longer exists\n", state.Pod.Id)
+		state.Pod = nil
+	case pod != nil && state.Pod == nil:
+		fmt.Printf("Found pod %s\n", pod.Id)
+		state.Pod = &PodState{Id: pod.Id, Name: pod.Name}
+	}
+
+	endpointName := environmentResourceName(config, "endpoint")
+	var endpoint *api.Endpoint
+	for _, candidate := range endpoints {
+		if (state.Endpoint != nil && candidate.Id == state.Endpoint.Id) || (endpoint == nil && strings.TrimSuffix(candidate.Name, "-fb") == endpointName) {
+			endpoint = candidate
+		}
+	}
+	switch {
+	case endpoint == nil && state.Endpoint != nil:
+		fmt.Printf("Endpoint %s no longer exists\n", state.Endpoint.Id)
+		state.Endpoint = nil
+	case endpoint != nil && state.Endpoint == nil:
+		fmt.Printf("Found endpoint %s\n", endpoint.Id)
+		state.Endpoint = &EndpointState{Id: endpoint.Id, Name: endpoint.Name, TemplateId: endpoint.TemplateId}
+	case endpoint != nil && endpoint.TemplateId != state.Endpoint.TemplateId:
+		fmt.Printf("Endpoint %s now uses template %s\n", endpoint.Id, endpoint.TemplateId)
+		state.Endpoint.TemplateId = endpoint.TemplateId
+		state.Endpoint.TemplateName, state.Endpoint.Image = "", ""
+	}
+
+	if state.NetworkVolume != nil {
+		found := false
+		for _, volume := range volumes {
+			found = found || volume.Id == state.NetworkVolume.Id
+		}
+		if !found {
+			fmt.Printf("Network volume %s no longer exists\n", state.NetworkVolume.Id)
+			state.NetworkVolume = nil
+		}
+	}
+
+	if err := state.save(); err != nil {
+		return err
+	}
+	fmt.Printf("Refreshed environment %s\n", state.environment)
+	return nil
+}
+
+func forgetProjectState() error {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	environment, err := currentEnvironment()
+	if err != nil {
+		return err
+	}
+
+	err = updateStateFile(config.Dir(), func(file *stateFile) error {
+		entry := file.Projects[config.Project.Uuid]
+		switch {
+		case entry == nil:
+		case forgetAll:
+			delete(file.Projects, config.Project.Uuid)
+		default:
+			delete(entry.Environments, environment)
+			pruneStateFile(file)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if forgetAll {
+		fmt.Println("Forgot all environments of the project")
+	} else {
+		fmt.Printf("Forgot environment %s\n", environment)
+	}
+	fmt.Println("Resources on RunPod were left untouched.")
+	return nil
+}
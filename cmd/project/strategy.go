@@ -0,0 +1,378 @@
+package project
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yourusername/airfoil/api"
+)
+
+const (
+	strategyInPlace   string = "in-place"
+	strategyBlueGreen string = "blue-green"
+	strategyCanary    string = "canary"
+
+	// smokeTestInputFile is the job input the runpod SDK uses for local
+	// tests, sent to new deploys as a smoke test.
+	smokeTestInputFile string = "test_input.json"
+
+	// smokeTestStatusRetries is how many status requests in a row may fail
+	// before the smoke test gives up on its job.
+	smokeTestStatusRetries = 5
+)
+
+var (
+	deployStrategy   string
+	skipSmokeTest    bool
+	smokeTestTimeout time.Duration
+)
+
+var deployPromoteCmd = &cobra.Command{
+	Use:   "promote",
+	Short: "Point the stable endpoint at the canary template and remove the canary",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := promoteCanary(); err != nil {
+			fmt.Println("Failed to promote canary:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var deployDiscardCmd = &cobra.Command{
+	Use:   "discard",
+	Short: "Remove the canary endpoint, leaving the stable endpoint as it is",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := discardCanary(); err != nil {
+			fmt.Println("Failed to discard canary:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	DeployProjectCmd.AddCommand(deployPromoteCmd)
+	DeployProjectCmd.AddCommand(deployDiscardCmd)
+
+	deployPromoteCmd.Flags().BoolVar(&tagRelease, "tag-release", false, "Create a git tag for the promoted deploy when the environment is production")
+}
+
+func validateDeployStrategy() error {
+	switch deployStrategy {
+	case strategyInPlace, strategyBlueGreen, strategyCanary:
+		return nil
+	}
+	return fmt.Errorf("unknown strategy %q, use %s, %s or %s", deployStrategy, strategyInPlace, strategyBlueGreen, strategyCanary)
+}
+
+// readSmokeTestInput returns the contents of test_input.json, or nil when
+// there is none or the smoke test is skipped. Blue/green and canary deploys
+// need it, as the smoke test is what gates them.
+func readSmokeTestInput(config *ProjectConfig) ([]byte, error) {
+	if deployStrategy != strategyInPlace && skipSmokeTest {
+		return nil, fmt.Errorf("%s deploys are gated by the smoke test and cannot skip it", deployStrategy)
+	}
+	if skipSmokeTest {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(filepath.Join(config.Dir(), smokeTestInputFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && deployStrategy == strategyInPlace {
+			return nil, nil
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%s deploys need a %s to smoke test the new endpoint", deployStrategy, smokeTestInputFile)
+		}
+		return nil, fmt.Errorf("reading %s: %w", smokeTestInputFile, err)
+	}
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(content, &payload); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", smokeTestInputFile, err)
+	}
+	if _, ok := payload["input"]; !ok {
+		return nil, fmt.Errorf(`%s must be an object with an "input" key`, smokeTestInputFile)
+	}
+	return content, nil
+}
+
+// runSmokeTest sends the smoke test input to the endpoint as a job and waits
+// for it to complete. A nil input skips the test. A job that does not
+// complete in time is cancelled, so it does not keep a worker busy.
+func runSmokeTest(endpointId string, input []byte) error {
+	if input == nil {
+		return nil
+	}
+
+	fmt.Printf("Running smoke test %s on endpoint %s\n", smokeTestInputFile, endpointId)
+	job, err := api.RunJob(endpointId, input)
+	if err != nil {
+		return fmt.Errorf("smoke test: starting job: %w", err)
+	}
+
+	deadline := time.Now().Add(smokeTestTimeout)
+	status := job.Status
+	failures := 0
+	fmt.Printf("%sJob %s: %s\n", inputPromptPrefix, job.Id, status)
+	for !job.Done() {
+		if time.Now().After(deadline) {
+			cancelSmokeTest(endpointId, job.Id)
+			return fmt.Errorf("smoke test: job %s did not complete within %s, last status %s", job.Id, smokeTestTimeout, job.Status)
+		}
+		time.Sleep(2 * time.Second)
+
+		current, err := api.GetJobStatus(endpointId, job.Id)
+		if err != nil {
+			failures++
+			if failures >= smokeTestStatusRetries {
+				cancelSmokeTest(endpointId, job.Id)
+				return fmt.Errorf("smoke test: getting status of job %s: %w", job.Id, err)
+			}
+			fmt.Printf("%sGetting status of job %s failed, retrying: %s\n", inputPromptPrefix, job.Id, err)
+			continue
+		}
+		job, failures = current, 0
+		if job.Status != status {
+			status = job.Status
+			fmt.Printf("%sJob %s: %s\n", inputPromptPrefix, job.Id, status)
+		}
+	}
+
+	if job.Status != api.JobCompleted {
+		if job.Error != "" {
+			return fmt.Errorf("smoke test: job %s ended with %s: %s", job.Id, job.Status, job.Error)
+		}
+		return fmt.Errorf("smoke test: job %s ended with %s", job.Id, job.Status)
+	}
+	fmt.Println("Smoke test passed")
+	return nil
+}
+
+func cancelSmokeTest(endpointId, jobId string) {
+	fmt.Printf("%sCancelling job %s\n", inputPromptPrefix, jobId)
+	if _, err := api.CancelJob(endpointId, jobId); err != nil {
+		fmt.Printf("%sCould not cancel it: %s\n", inputPromptPrefix, err)
+	}
+}
+
+// createTemporaryEndpoint creates an endpoint of the given kind next to the
+// stable one, with the endpoint settings of the plan but no idle workers.
+func createTemporaryEndpoint(config *ProjectConfig, plan *deployPlan, kind, templateId string) (*api.CreateEndpointInput, error) {
+	input := *plan.Input
+	input.Name = projectEndpointName(config, kind)
+	input.TemplateId = templateId
+	input.WorkersMin = 0
+
+	fmt.Printf("Creating %s endpoint %s\n", kind, input.Name)
+	endpointId, err := api.CreateEndpoint(&input)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s endpoint: %w", kind, err)
+	}
+	input.Id = endpointId
+	return &input, nil
+}
+
+// deleteProjectEndpoint scales an endpoint down and deletes it. RunPod does
+// not delete endpoints that still have workers.
+func deleteProjectEndpoint(config *ProjectConfig, endpointId, name, templateId string) error {
+	input, err := projectEndpointInput(config, templateId)
+	if err != nil {
+		return err
+	}
+	input.Id = endpointId
+	input.Name = name
+	input.WorkersMin, input.WorkersMax = 0, 0
+	if _, err := api.CreateEndpoint(input); err != nil {
+		return fmt.Errorf("scaling down endpoint %s: %w", endpointId, err)
+	}
+	if err := api.DeleteEndpoint(endpointId); err != nil {
+		return fmt.Errorf("deleting endpoint %s: %w", endpointId, err)
+	}
+	return nil
+}
+
+// removeUnusedTemplate deletes the template of a failed deploy or discarded
+// canary. It has to go after the endpoint that used it.
+func removeUnusedTemplate(templateName string) {
+	fmt.Printf("Removing template %s\n", templateName)
+	if err := api.DeleteTemplate(templateName); err != nil {
+		fmt.Printf("%sCould not remove it, delete it in the console: %s\n", inputPromptPrefix, err)
+	}
+}
+
+// deployBlueGreen creates a fresh endpoint with the new template, smoke tests
+// it, and only then points the stable endpoint at the template. The fresh
+// endpoint is removed either way, the template too when the smoke test fails.
+func deployBlueGreen(config *ProjectConfig, state *ProjectState, plan *deployPlan, smokeInput []byte) error {
+	if plan.Endpoint == nil || len(plan.TemplateChanges) == 0 {
+		fmt.Println("No stable template to protect, deploying in place")
+		return deployInPlace(config, state, plan, smokeInput)
+	}
+
+	templateId, templateName, err := createProjectTemplate(config, plan)
+	if err != nil {
+		return err
+	}
+	green, err := createTemporaryEndpoint(config, plan, "green", templateId)
+	if err != nil {
+		return err
+	}
+	smokeFailed := false
+	defer func() {
+		fmt.Printf("Removing green endpoint %s\n", green.Id)
+		if err := deleteProjectEndpoint(config, green.Id, green.Name, templateId); err != nil {
+			fmt.Printf("%sCould not remove it, delete it in the console: %s\n", inputPromptPrefix, err)
+			return
+		}
+		if smokeFailed {
+			removeUnusedTemplate(templateName)
+		}
+	}()
+
+	if err := runSmokeTest(green.Id, smokeInput); err != nil {
+		smokeFailed = true
+		return fmt.Errorf("%w, endpoint %s was not changed", err, plan.Endpoint.Id)
+	}
+
+	endpoint, err := applyToStable(config, state, plan, templateId, templateName, plan.Image)
+	if err != nil {
+		return err
+	}
+	if err := state.save(); err != nil {
+		return err
+	}
+	printDeployed(plan.Image, endpoint.Id)
+	return nil
+}
+
+// deployCanary creates a canary endpoint with the new template next to the
+// stable one and smoke tests it. The canary stays up until it is promoted or
+// discarded, so part of the traffic can be sent to it in the meantime.
+func deployCanary(config *ProjectConfig, state *ProjectState, plan *deployPlan, smokeInput []byte) error {
+	if state.Canary != nil {
+		return fmt.Errorf("canary endpoint %s is still deployed, run airfoil deploy promote or airfoil deploy discard first", state.Canary.Id)
+	}
+	if plan.Endpoint == nil || len(plan.TemplateChanges) == 0 {
+		fmt.Println("No stable template to protect, deploying in place")
+		return deployInPlace(config, state, plan, smokeInput)
+	}
+
+	templateId, templateName, err := createProjectTemplate(config, plan)
+	if err != nil {
+		return err
+	}
+	canary, err := createTemporaryEndpoint(config, plan, "canary", templateId)
+	if err != nil {
+		return err
+	}
+
+	if err := runSmokeTest(canary.Id, smokeInput); err != nil {
+		fmt.Printf("Removing canary endpoint %s\n", canary.Id)
+		if err := deleteProjectEndpoint(config, canary.Id, canary.Name, templateId); err != nil {
+			fmt.Printf("%sCould not remove it, delete it in the console: %s\n", inputPromptPrefix, err)
+		} else {
+			removeUnusedTemplate(templateName)
+		}
+		return fmt.Errorf("%w, endpoint %s was not changed", err, plan.Endpoint.Id)
+	}
+
+	state.Canary = &EndpointState{
+		Id:           canary.Id,
+		Name:         canary.Name,
+		TemplateId:   templateId,
+		TemplateName: templateName,
+		Image:        plan.Image,
+		DeployedAt:   time.Now().UTC(),
+		gitRevision:  plan.Revision,
+	}
+	if err := state.save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Deployed canary %s to endpoint %s\n", plan.Image, canary.Id)
+	fmt.Printf("%shttps://api.runpod.ai/v2/%s/runsync\n", inputPromptPrefix, canary.Id)
+	fmt.Println("Send part of your traffic to it, then run airfoil deploy promote or airfoil deploy discard.")
+	if len(plan.EndpointChanges) > 0 {
+		fmt.Println("Endpoint setting changes are not part of the canary, run airfoil deploy after promoting to apply them.")
+	}
+	return nil
+}
+
+func promoteCanary() error {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	state, err := loadProjectState(config)
+	if err != nil {
+		return err
+	}
+	if state.Canary == nil {
+		return fmt.Errorf("environment %s has no canary", state.environment)
+	}
+	endpoint, err := findProjectEndpoint(config, state)
+	if err != nil {
+		return err
+	}
+	if endpoint == nil {
+		return errors.New("the stable endpoint no longer exists")
+	}
+
+	canary := state.Canary
+	fmt.Printf("Updating endpoint %s to template %s\n", endpoint.Id, canary.TemplateId)
+	if err := api.UpdateEndpointTemplate(endpoint.Id, canary.TemplateId); err != nil {
+		return fmt.Errorf("updating endpoint %s: %w", endpoint.Id, err)
+	}
+
+	state.Endpoint = &EndpointState{
+		Id:           endpoint.Id,
+		Name:         endpoint.Name,
+		TemplateId:   canary.TemplateId,
+		TemplateName: canary.TemplateName,
+		Image:        canary.Image,
+		DeployedAt:   time.Now().UTC(),
+		gitRevision:  canary.gitRevision,
+	}
+	state.recordDeploy(newDeployRecord(canary.gitRevision, endpoint.Id, canary.TemplateId, canary.TemplateName, canary.Image))
+
+	fmt.Printf("Removing canary endpoint %s\n", canary.Id)
+	if err := deleteProjectEndpoint(config, canary.Id, canary.Name, canary.TemplateId); err != nil {
+		fmt.Printf("%sCould not remove it, delete it in the console: %s\n", inputPromptPrefix, err)
+	}
+	state.Canary = nil
+	if err := state.save(); err != nil {
+		return err
+	}
+
+	printDeployed(canary.Image, endpoint.Id)
+	return tagDeployRelease(state)
+}
+
+func discardCanary() error {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	state, err := loadProjectState(config)
+	if err != nil {
+		return err
+	}
+	if state.Canary == nil {
+		return fmt.Errorf("environment %s has no canary", state.environment)
+	}
+
+	fmt.Printf("Removing canary endpoint %s\n", state.Canary.Id)
+	if err := deleteProjectEndpoint(config, state.Canary.Id, state.Canary.Name, state.Canary.TemplateId); err != nil {
+		return err
+	}
+	removeUnusedTemplate(state.Canary.TemplateName)
+	state.Canary = nil
+	return state.save()
+}
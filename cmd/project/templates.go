@@ -0,0 +1,381 @@
+package project
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/yourusername/airfoil/format"
+)
+
+// templateSourceFile records where a cached template was fetched from.
+const templateSourceFile string = ".airfoil-source"
+
+var refreshTemplate bool
+
+var TemplatesCmd = &cobra.Command{
+	Use:     "templates",
+	Aliases: []string{"template"},
+	Short:   "Manage starter templates",
+	Long: `Manages the starter templates used by create.
+Besides the embedded templates, create --template accepts a local directory, a tarball
+or a git repository. Fetched templates are cached in ~/.airfoil/templates.
+Named sources can be configured in the config file:
+
+  templates:
+    internal: git@github.com:acme/handler-template.git#main`,
+}
+
+var templatesListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List embedded, cached and configured starter templates",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cobra.CheckErr(listTemplates())
+	},
+}
+
+func init() {
+	TemplatesCmd.AddCommand(templatesListCmd)
+}
+
+func templateCacheDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("getting user home directory: %w", err)
+	}
+	return filepath.Join(home, ".airfoil", "templates"), nil
+}
+
+// configuredTemplateSources returns the named template sources from the
+// "templates" key of the config file.
+func configuredTemplateSources() map[string]string {
+	return viper.GetStringMapString("templates")
+}
+
+var gitSourcePattern = regexp.MustCompile(`^(git@|git://|ssh://|git\+)|\.git(#.*)?$`)
+
+func isGitSource(source string) bool {
+	return gitSourcePattern.MatchString(source)
+}
+
+func isTarballSource(source string) bool {
+	lower := strings.ToLower(source)
+	return strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz") || strings.HasSuffix(lower, ".tar")
+}
+
+// findTemplate resolves a template reference to a manifest. A reference is
+// the name or alias of an embedded template, the name of a configured source,
+// a local directory, a tarball path or URL, or a git URL with an optional
+// #ref suffix.
+func findTemplate(ref string) (*TemplateManifest, error) {
+	if manifest, err := resolveStarterTemplate(ref); err == nil {
+		return manifest, nil
+	}
+
+	if source, ok := configuredTemplateSources()[strings.ToLower(ref)]; ok {
+		manifest, err := loadTemplateSource(source)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Name = ref
+		manifest.Source = ref
+		return manifest, nil
+	}
+
+	if isLocalDir(ref) || isTarballSource(ref) || isGitSource(ref) {
+		return loadTemplateSource(ref)
+	}
+
+	names := starterTemplateNames()
+	for name := range configuredTemplateSources() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown template %q, use a local directory, tarball, git URL or one of: %s", ref, strings.Join(names, ", "))
+}
+
+// loadTemplateSource loads a template from a local directory, or from the
+// cache after fetching it if needed.
+func loadTemplateSource(source string) (*TemplateManifest, error) {
+	dir := source
+	if !isLocalDir(source) {
+		var err error
+		dir, err = fetchTemplate(source)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := loadTemplateManifest(filepath.Base(absDir), os.DirFS(absDir))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest.Source = source
+	if isLocalDir(source) || (isTarballSource(source) && !strings.Contains(source, "://")) {
+		if manifest.Source, err = filepath.Abs(source); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+func isLocalDir(source string) bool {
+	info, err := os.Stat(source)
+	return err == nil && info.IsDir()
+}
+
+// fetchTemplate returns the cache directory for a remote or archived
+// template, fetching it when it is not cached yet or --refresh-template is set.
+func fetchTemplate(source string) (string, error) {
+	cacheDir, err := templateCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	if isTarballSource(source) && !strings.Contains(source, "://") {
+		if source, err = filepath.Abs(source); err != nil {
+			return "", err
+		}
+	}
+
+	sum := sha256.Sum256([]byte(source))
+	name := strings.Split(source, "#")[0]
+	name = strings.TrimSuffix(strings.TrimSuffix(name, "/"), ".git")
+	name = path.Base(strings.TrimSuffix(name, "/"))
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	dir := filepath.Join(cacheDir, name+"-"+hex.EncodeToString(sum[:])[:8])
+
+	if _, err := os.Stat(dir); err == nil && !refreshTemplate {
+		return dir, nil
+	}
+
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", fmt.Errorf("creating template cache: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(cacheDir, ".fetch-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fmt.Printf("Fetching template %s...\n", source)
+	fetched := filepath.Join(tmpDir, "template")
+	if isGitSource(source) {
+		err = cloneTemplate(source, fetched)
+	} else {
+		err = extractTemplateTarball(source, fetched)
+	}
+	if err != nil {
+		return "", fmt.Errorf("fetching template %s: %w", source, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(fetched, templateSourceFile), []byte(source+"\n"), 0644); err != nil {
+		return "", err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	if err := os.Rename(fetched, dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func cloneTemplate(source, dest string) error {
+	url, ref, _ := strings.Cut(strings.TrimPrefix(source, "git+"), "#")
+
+	args := []string{"clone", "--depth", "1", "--quiet"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	args = append(args, url, dest)
+
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running git clone: %w", err)
+	}
+
+	return os.RemoveAll(filepath.Join(dest, ".git"))
+}
+
+// extractTemplateTarball extracts a local or remote tarball into dest. When
+// the archive holds a single top-level directory, its contents are used.
+func extractTemplateTarball(source, dest string) error {
+	var reader io.Reader
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		client := &http.Client{Timeout: time.Minute}
+		res, err := client.Get(source)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("statuscode %d", res.StatusCode)
+		}
+		reader = res.Body
+	} else {
+		file, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	if !strings.HasSuffix(strings.ToLower(source), ".tar") {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("archive entry %q leaves the template directory", header.Name)
+		}
+		target := filepath.Join(dest, name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			// Keep executable bits, so scripts in the template stay runnable.
+			mode := os.FileMode(header.Mode).Perm() | 0o600
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(file, tarReader); err != nil {
+				file.Close()
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+			if err := os.Chmod(target, mode); err != nil {
+				return err
+			}
+		}
+	}
+
+	return unwrapSingleDir(dest)
+}
+
+// unwrapSingleDir moves the contents of dir's only subdirectory up into dir.
+func unwrapSingleDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(entries) != 1 || !entries[0].IsDir() {
+		return nil
+	}
+
+	inner := filepath.Join(dir, entries[0].Name())
+	innerEntries, err := os.ReadDir(inner)
+	if err != nil {
+		return err
+	}
+	for _, entry := range innerEntries {
+		if err := os.Rename(filepath.Join(inner, entry.Name()), filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return os.Remove(inner)
+}
+
+func listTemplates() error {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Version", "Kind", "Source", "Description"})
+	format.TableDefaults(table)
+
+	manifests, err := listStarterTemplates()
+	if err != nil {
+		return err
+	}
+	for _, manifest := range manifests {
+		table.Append([]string{manifest.Name, manifest.Version, "embedded", "", manifest.Description})
+	}
+
+	configured := configuredTemplateSources()
+	names := make([]string, 0, len(configured))
+	for name := range configured {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		table.Append([]string{name, "", "configured", configured[name], ""})
+	}
+
+	cacheDir, err := templateCacheDir()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		dir := filepath.Join(cacheDir, entry.Name())
+		source, _ := os.ReadFile(filepath.Join(dir, templateSourceFile))
+		version, description := "", ""
+		if manifest, err := loadTemplateManifest(entry.Name(), os.DirFS(dir)); err == nil {
+			version, description = manifest.Version, manifest.Description
+		}
+		table.Append([]string{entry.Name(), version, "cached", strings.TrimSpace(string(source)), description})
+	}
+
+	table.Render()
+	return nil
+}
@@ -4,14 +4,98 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/google/uuid"
+	"github.com/pelletier/go-toml/v2"
 )
 
-func generateProjectToml(projectFolder, filename, projectName, cudaVersion, pythonVersion string) {
+var defaultGpuTypes = []string{
+	"NVIDIA GeForce RTX 4080",
+	"NVIDIA RTX A4000",
+	"NVIDIA RTX A4500",
+	"NVIDIA RTX A5000",
+	"NVIDIA GeForce RTX 3090",
+	"NVIDIA GeForce RTX 4090",
+	"NVIDIA RTX A6000",
+	"NVIDIA A100 80GB PCIe",
+}
+
+// gpuMemoryGb is used to annotate gpu_types in generated project files.
+var gpuMemoryGb = map[string]int{
+	"NVIDIA GeForce RTX 4080": 16,
+	"NVIDIA RTX A4000":        16,
+	"NVIDIA RTX A4500":        20,
+	"NVIDIA RTX A5000":        24,
+	"NVIDIA GeForce RTX 3090": 24,
+	"NVIDIA GeForce RTX 4090": 24,
+	"NVIDIA L4":               24,
+	"NVIDIA RTX A6000":        48,
+	"NVIDIA L40S":             48,
+	"NVIDIA A40":              48,
+	"NVIDIA A100 80GB PCIe":   80,
+	"NVIDIA A100-SXM4-80GB":   80,
+	"NVIDIA H100 80GB HBM3":   80,
+	"NVIDIA H100 PCIe":        80,
+}
+
+// tomlString encodes value as a TOML basic string.
+func tomlString(value string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range value {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// formatGpuTypes renders the entries of the gpu_types array, one per line.
+func formatGpuTypes(gpuTypes []string) string {
+	if len(gpuTypes) == 0 {
+		gpuTypes = defaultGpuTypes
+	}
+
+	width := 0
+	for _, gpuType := range gpuTypes {
+		width = max(width, len(gpuType)+3)
+	}
+
+	var b strings.Builder
+	for _, gpuType := range gpuTypes {
+		entry := tomlString(gpuType) + ","
+		if memory, ok := gpuMemoryGb[gpuType]; ok {
+			fmt.Fprintf(&b, "    %-*s # %dGB\n", width, entry, memory)
+		} else {
+			fmt.Fprintf(&b, "    %s\n", entry)
+		}
+	}
+	return b.String()
+}
+
+// projectTomlValues are the settings written to a new runpod.toml.
+type projectTomlValues struct {
+	Name             string
+	BaseImage        string
+	GpuTypes         []string
+	PythonVersion    string
+	HandlerPath      string
+	RequirementsPath string
+	Template         *TemplateRecord
+}
+
+func generateProjectToml(projectFolder, filename string, values projectTomlValues) error {
 	template := `# RunPod Project Configuration
 
-name = "%s"
+name = %s
 
 [project]
 # uuid                   - Unique identifier for the project. Automatically generated.
@@ -23,6 +107,7 @@ name = "%s"
 #
 # gpu_types              - List of GPU types for your development pod. Order the types from most preferred to least preferred.
 #                        - The pod uses the first available type from this list.
+#                        - Use GPU type ids, display names such as "RTX 4090", or serverless pool ids such as "AMPERE_48".
 #                        - For a full list of supported GPU types, visit: https://docs.runpod.io/references/gpu-types
 #
 # gpu_count              - Number of GPUs to allocate for this pod.
@@ -30,23 +115,19 @@ name = "%s"
 # ports                  - Ports to expose and their protocols. Configure as needed for your application.
 #
 # container_disk_size_gb - Disk space allocated to the container. Adjust according to your needs.
+#
+# env_file               - Optional path to a dotenv file. Its variables are added to the pod environment
+#                        - and can be referenced from env_vars. Keep this file out of version control.
 
-uuid = "%s"
-base_image = "runpod/base:0.6.1-cuda%s"
+uuid = %s
+base_image = %s
 gpu_types = [
-    "NVIDIA GeForce RTX 4080",  # 16GB
-    "NVIDIA RTX A4000",         # 16GB
-    "NVIDIA RTX A4500",         # 20GB
-    "NVIDIA RTX A5000",         # 24GB
-    "NVIDIA GeForce RTX 3090",  # 24GB
-    "NVIDIA GeForce RTX 4090",  # 24GB
-    "NVIDIA RTX A6000",         # 48GB
-    "NVIDIA A100 80GB PCIe",    # 80GB
-]
+%s]
 gpu_count = 1
 volume_mount_path = "/runpod-volume"
 ports = "4040/http, 7270/http, 22/tcp" # FileBrowser, FastAPI, SSH
 container_disk_size_gb = 100
+# env_file = ".env"
 
 [project.env_vars]
 # Set environment variables for the pod.
@@ -58,6 +139,10 @@ container_disk_size_gb = 100
 # RUNPOD_DEBUG_LEVEL     - Log level for RunPod. Set to 'debug' for detailed logs.
 #
 # UVICORN_LOG_LEVEL      - Log level for Uvicorn. Set to 'warning' for minimal logs.
+#
+# Values can reference local variables with ${VAR}, resolved from your shell or env_file,
+# or RunPod secrets with {{ RUNPOD_SECRET_name }}, resolved by RunPod when the pod starts.
+# e.g. HF_TOKEN = "{{ RUNPOD_SECRET_hf_token }}"
 
 POD_INACTIVITY_TIMEOUT = "120"
 RUNPOD_DEBUG_LEVEL = "debug"
@@ -72,10 +157,18 @@ UVICORN_LOG_LEVEL = "warning"
 #                - These workers respond to job requests without any cold start delay.
 #
 # max_workers    - The maximum number of workers your endpoint has running at any given point.
+#
+# idle_timeout   - Seconds a worker stays up after its last job before it is scaled down.
+#
+# locations      - Data centers to run workers in, e.g. ["EU-RO-1"]. Leave empty to use any.
+#
+# network_volume_id - Network volume to attach to the workers, if any.
 
 active_workers = 0
 max_workers = 3
 flashboot = true
+idle_timeout = 5
+locations = []
 
 [runtime]
 # python_version    - Python version to use for the project.
@@ -83,19 +176,48 @@ flashboot = true
 # handler_path      - Path to the handler file for the project. Adapt example scripts from Hugging Face in this file.
 #
 # requirements_path - Path to the requirements file for the project. Add dependencies from Hugging Face in this file.
+#
+# system_packages   - apt packages to install on top of the base image, e.g. ["ffmpeg", "libsndfile1"].
+#
+# build_steps       - Shell commands run from the project folder after the requirements are installed,
+#                   - both in the built image and on the development pod at the start of each session.
 
-python_version = "%s"
-handler_path = "src/handler.py"
-requirements_path = "builder/requirements.txt"
+python_version = %s
+handler_path = %s
+requirements_path = %s
+system_packages = []
+build_steps = []
 `
 
 	// Format the template with dynamic content
-	content := fmt.Sprintf(template, projectName, uuid.New().String()[0:8], cudaVersion, pythonVersion)
+	content := fmt.Sprintf(template, tomlString(values.Name), tomlString(uuid.New().String()[0:8]), tomlString(values.BaseImage),
+		formatGpuTypes(values.GpuTypes), tomlString(values.PythonVersion), tomlString(values.HandlerPath), tomlString(values.RequirementsPath))
+
+	if values.Template != nil {
+		section, err := templateRecordSection(values.Template)
+		if err != nil {
+			return err
+		}
+		content += "\n" + section
+	}
 
 	// Write the content to a TOML file
 	tomlPath := filepath.Join(projectFolder, filename)
-	err := os.WriteFile(tomlPath, []byte(content), 0644)
+	if err := os.WriteFile(tomlPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", filename, err)
+	}
+	return nil
+}
+
+const templateRecordComment = "# Starter template this project was created from. Used by 'airfoil template upgrade', do not edit."
+
+// templateRecordSection encodes record as the [template] section of runpod.toml.
+func templateRecordSection(record *TemplateRecord) (string, error) {
+	section, err := toml.Marshal(struct {
+		Template *TemplateRecord `toml:"template"`
+	}{record})
 	if err != nil {
-		fmt.Printf("Failed to write the TOML file: %s\n", err)
+		return "", fmt.Errorf("encoding template record: %w", err)
 	}
+	return templateRecordComment + "\n" + string(section), nil
 }
@@ -0,0 +1,25 @@
+package project
+
+import (
+	"testing"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+func TestTomlString(t *testing.T) {
+	tests := []string{"my-worker", `say "hi"`, `C:\models`, "tab\there", "bell\a", "ünïcode"}
+
+	for _, value := range tests {
+		t.Run(value, func(t *testing.T) {
+			var decoded struct {
+				Name string `toml:"name"`
+			}
+			if err := toml.Unmarshal([]byte("name = "+tomlString(value)+"\n"), &decoded); err != nil {
+				t.Fatalf("decoding %s: %v", tomlString(value), err)
+			}
+			if decoded.Name != value {
+				t.Errorf("tomlString(%q) decodes to %q", value, decoded.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,367 @@
+package project
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+)
+
+// templateSnapshotDir holds the starter template as it was last rendered into
+// the project. It is the common ancestor for template upgrades.
+const templateSnapshotDir string = ".runpod/template"
+
+var (
+	upgradeTemplateSource string
+	upgradeDryRun         bool
+)
+
+var templatesUpgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade the current project to the latest version of its starter template",
+	Long: `Renders the latest version of the starter template recorded in runpod.toml with the
+values the project was created with, and merges the changes into the project files.
+Local edits are kept. Where a file was changed both locally and in the template, the
+conflicting lines are written with <<<<<<< / >>>>>>> markers to be resolved by hand.
+The planned changes are shown before anything is written.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := upgradeProject(); err != nil {
+			fmt.Println("Failed to upgrade project:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	TemplatesCmd.AddCommand(templatesUpgradeCmd)
+
+	templatesUpgradeCmd.Flags().StringVar(&upgradeTemplateSource, "template", "", "Upgrade from this template source instead of the one recorded in runpod.toml")
+	templatesUpgradeCmd.Flags().BoolVar(&upgradeDryRun, "dry-run", false, "Show the planned changes without writing them")
+	templatesUpgradeCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Apply the changes without asking for confirmation")
+}
+
+// upgradeChange is the planned change to a single project file.
+type upgradeChange struct {
+	Path      string
+	Action    string
+	Old       string
+	New       string
+	Conflicts int
+	// Mode is the mode of the template file for added and updated files.
+	// Merged files keep the mode they have in the project.
+	Mode fs.FileMode
+}
+
+const (
+	upgradeAdd      = "add"
+	upgradeUpdate   = "update"
+	upgradeMerge    = "merge"
+	upgradeConflict = "conflict"
+	upgradeRemove   = "remove"
+	upgradeSkip     = "skip"
+)
+
+func upgradeProject() error {
+	config, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	if config.Template == nil || config.Template.Name == "" {
+		return fmt.Errorf("%s has no [template] section, the project was not created from a starter template", projectConfigFile)
+	}
+	record := *config.Template
+
+	source := record.Source
+	if upgradeTemplateSource != "" {
+		source = upgradeTemplateSource
+	}
+	if source == "" {
+		source = record.Name
+	}
+
+	// Always fetch remote templates again, the cached copy may be the old version.
+	refreshTemplate = true
+	starterTemplate, err := findTemplate(source)
+	if err != nil {
+		return err
+	}
+
+	// Keep the recorded values of variables the new version still declares.
+	values := map[string]string{}
+	for _, variable := range starterTemplate.Variables {
+		if value, ok := record.Vars[variable.Name]; ok {
+			values[variable.Name] = value
+		}
+	}
+	if record.Vars, err = starterTemplate.resolveVariables(values); err != nil {
+		return err
+	}
+	record.Name = starterTemplate.Name
+	record.Source = starterTemplate.Source
+	record.Version = starterTemplate.Version
+
+	renderDir, err := os.MkdirTemp("", "airfoil-upgrade-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(renderDir)
+
+	if err := renderStarterTemplate(starterTemplate, renderDir, config.Name, &record); err != nil {
+		return err
+	}
+
+	snapshotDir := filepath.Join(config.Dir(), templateSnapshotDir)
+	base, _, err := readTree(snapshotDir)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", templateSnapshotDir, err)
+	}
+	if len(base) == 0 {
+		fmt.Printf("No %s snapshot found, files changed since creation will show as conflicts.\n", templateSnapshotDir)
+	}
+	theirs, theirsModes, err := readTree(renderDir)
+	if err != nil {
+		return err
+	}
+
+	changes, err := planUpgrade(config.Dir(), base, theirs, theirsModes, record.Version)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 && record.Version == config.Template.Version {
+		fmt.Printf("Project is up to date with template %s %s.\n", record.Name, displayVersion(record.Version))
+		return nil
+	}
+
+	fmt.Printf("Upgrading from template %s %s to %s\n", record.Name, displayVersion(config.Template.Version), displayVersion(record.Version))
+	if len(changes) == 0 {
+		fmt.Println("No file changes.")
+	}
+	printUpgradePlan(changes)
+
+	if upgradeDryRun {
+		return nil
+	}
+	if !assumeYes && len(changes) > 0 {
+		confirm := promptui.Prompt{Label: "Apply these changes", IsConfirm: true}
+		if _, err := confirm.Run(); err != nil {
+			fmt.Println("Nothing was written.")
+			return nil
+		}
+	}
+
+	conflicts := 0
+	for _, change := range changes {
+		target := filepath.Join(config.Dir(), filepath.FromSlash(change.Path))
+		switch change.Action {
+		case upgradeAdd, upgradeUpdate, upgradeMerge, upgradeConflict:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			mode := change.Mode
+			if mode == 0 {
+				mode = 0644
+			}
+			if err := os.WriteFile(target, []byte(change.New), mode); err != nil {
+				return fmt.Errorf("writing %s: %w", change.Path, err)
+			}
+			// WriteFile only applies the mode to new files.
+			if change.Mode != 0 {
+				if err := os.Chmod(target, change.Mode); err != nil {
+					return fmt.Errorf("writing %s: %w", change.Path, err)
+				}
+			}
+		case upgradeRemove:
+			if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("removing %s: %w", change.Path, err)
+			}
+		}
+		conflicts += change.Conflicts
+	}
+
+	if err := os.RemoveAll(snapshotDir); err != nil {
+		return fmt.Errorf("updating %s: %w", templateSnapshotDir, err)
+	}
+	if err := renderStarterTemplate(starterTemplate, snapshotDir, config.Name, &record); err != nil {
+		return err
+	}
+	if err := updateTemplateRecord(config.Dir(), &record); err != nil {
+		return err
+	}
+
+	if conflicts > 0 {
+		fmt.Printf("Upgraded with %d conflict(s), resolve the <<<<<<< markers before running the project.\n", conflicts)
+		return nil
+	}
+	fmt.Println("Project upgraded successfully.")
+	return nil
+}
+
+// planUpgrade compares the old template render (base), the project files and
+// the new template render (theirs), and returns the changes to make.
+func planUpgrade(projectDir string, base, theirs map[string]string, theirsModes map[string]fs.FileMode, version string) ([]upgradeChange, error) {
+	paths := []string{}
+	for p := range base {
+		paths = append(paths, p)
+	}
+	for p := range theirs {
+		if _, ok := base[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	changes := []upgradeChange{}
+	for _, p := range paths {
+		baseText, inBase := base[p]
+		theirsText, inTheirs := theirs[p]
+
+		content, err := os.ReadFile(filepath.Join(projectDir, filepath.FromSlash(p)))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		inOurs := err == nil
+		ours := string(content)
+
+		change := upgradeChange{Path: p, Old: ours}
+		switch {
+		case inTheirs && inBase && baseText == theirsText:
+			continue
+		case !inTheirs && !inOurs:
+			continue
+		case !inTheirs && ours == baseText:
+			change.Action = upgradeRemove
+		case !inTheirs:
+			change.Action = upgradeSkip
+			change.New = ours
+			fmt.Printf("%s was removed from the template but changed locally, keeping it.\n", p)
+		case !inOurs && inBase:
+			change.Action = upgradeSkip
+			fmt.Printf("%s was deleted locally, not restoring it.\n", p)
+		case !inOurs:
+			change.Action = upgradeAdd
+			change.New = theirsText
+			change.Mode = theirsModes[p]
+		case ours == theirsText:
+			continue
+		case inBase && ours == baseText:
+			change.Action = upgradeUpdate
+			change.New = theirsText
+			change.Mode = theirsModes[p]
+		default:
+			merged := mergeThreeWay(baseText, ours, theirsText, "project", "template "+displayVersion(version))
+			change.New = merged.Text
+			change.Conflicts = merged.Conflicts
+			change.Action = upgradeMerge
+			if merged.Conflicts > 0 {
+				change.Action = upgradeConflict
+			}
+		}
+
+		if change.Action == upgradeSkip {
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func printUpgradePlan(changes []upgradeChange) {
+	for _, change := range changes {
+		fmt.Printf("%s%-8s %s\n", inputPromptPrefix, change.Action, change.Path)
+	}
+	for _, change := range changes {
+		if diff := unifiedDiff("a/"+change.Path, "b/"+change.Path, change.Old, change.New); diff != "" {
+			fmt.Println()
+			fmt.Print(diff)
+		}
+	}
+}
+
+func displayVersion(version string) string {
+	if version == "" {
+		return "(unversioned)"
+	}
+	return version
+}
+
+// readTree returns the content and permissions of every regular file below
+// dir, keyed by slash-separated relative path. A missing dir is empty.
+func readTree(dir string) (map[string]string, map[string]fs.FileMode, error) {
+	tree := map[string]string{}
+	modes := map[string]fs.FileMode{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		tree[filepath.ToSlash(relPath)] = string(content)
+		modes[filepath.ToSlash(relPath)] = info.Mode().Perm()
+		return nil
+	})
+	return tree, modes, err
+}
+
+// updateTemplateRecord replaces the [template] section of the project's
+// runpod.toml, leaving the rest of the file as it is.
+func updateTemplateRecord(projectDir string, record *TemplateRecord) error {
+	tomlPath := filepath.Join(projectDir, projectConfigFile)
+	content, err := os.ReadFile(tomlPath)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", projectConfigFile, err)
+	}
+
+	var kept []string
+	inSection := false
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			inSection = trimmed == "[template]" || strings.HasPrefix(trimmed, "[template.")
+		}
+		if inSection || trimmed == templateRecordComment {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	section, err := templateRecordSection(record)
+	if err != nil {
+		return err
+	}
+	updated := strings.TrimRight(strings.Join(kept, "\n"), "\n") + "\n\n" + section
+
+	if err := os.WriteFile(tomlPath, []byte(updated), 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", projectConfigFile, err)
+	}
+	return nil
+}
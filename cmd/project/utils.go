@@ -44,15 +44,15 @@ func promptChoice(message string, choices []string, defaultChoice string) string
 	return selection
 }
 
-func selectNetworkVolume() (networkVolumeId string, err error) {
+func selectNetworkVolume() (networkVolume *api.NetworkVolume, err error) {
 	networkVolumes, err := api.GetNetworkVolumes()
 	if err != nil {
 		fmt.Println("Error fetching network volumes:", err)
-		return "", err
+		return nil, err
 	}
 	if len(networkVolumes) == 0 {
 		fmt.Println("No network volumes found. Please create one and try again. (https://runpod.io/console/user/storage)")
-		return "", fmt.Errorf("no network volumes found")
+		return nil, fmt.Errorf("no network volumes found")
 	}
 
 	promptTemplates := &promptui.SelectTemplates{
@@ -73,10 +73,9 @@ func selectNetworkVolume() (networkVolumeId string, err error) {
 	}
 	i, _, err := getNetworkVolume.Run()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	networkVolumeId = options[i].Value
-	return networkVolumeId, nil
+	return networkVolumes[i], nil
 }
 
 func selectStarterTemplate() (template string, err error) {
@@ -84,7 +83,7 @@ func selectStarterTemplate() (template string, err error) {
 		Name  string
 		Value string
 	}
-	templates, err := starterTemplates.ReadDir("starter_examples")
+	templates, err := starterTemplates.ReadDir(basePath)
 	if err != nil {
 		fmt.Println("Something went wrong trying to fetch the starter project.")
 		fmt.Println(err)
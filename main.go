@@ -32,9 +32,16 @@ func init() {
 	rootCmd.Flags().BoolVarP(&versionFlag, "version", "v", false, "Print the version number of Airfoil")
 
 	rootCmd.AddCommand(project.NewProjectCmd)
+	rootCmd.AddCommand(project.InitProjectCmd)
 	rootCmd.AddCommand(project.StartProjectCmd)
 	rootCmd.AddCommand(project.DeployProjectCmd)
 	rootCmd.AddCommand(project.BuildProjectCmd)
+	rootCmd.AddCommand(project.SecretsCmd)
+	rootCmd.AddCommand(project.TemplatesCmd)
+	rootCmd.AddCommand(project.EstimateCmd)
+	rootCmd.AddCommand(project.ImageCmd)
+	rootCmd.AddCommand(project.StateCmd)
+	rootCmd.AddCommand(project.DestroyProjectCmd)
 }
 
 func initConfig() {